@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/// Matches the class lines of a mapping file, e.g. `com.example.Foo -> a.b:`
+var mappingClassLine = regexp.MustCompile(`^\S+ -> \S+:$`)
+
+/// Directories never searched for mapping files
+var skippedSearchDirs = map[string]bool{
+	".git":         true,
+	".gradle":      true,
+	".idea":        true,
+	"node_modules": true,
+}
+
+// MappingFile is a Proguard / R8 mapping along with the Gradle module and
+// build variant that produced it, when they can be told from its path
+type MappingFile struct {
+	Module  string
+	Variant string
+	Path    string
+}
+
+// Label names the mapping in logs and reports: the variant, prefixed with
+// the module for modules other than `app`
+func (m MappingFile) Label() string {
+	if m.Module == "" || m.Module == "app" {
+		return m.Variant
+	}
+	if m.Variant == "" {
+		return m.Module
+	}
+	return m.Module + ":" + m.Variant
+}
+
+// resolveMappings turns `proguard_mapping_path` into the mapping files to
+// upload. A file is used as-is, while a directory is searched for the
+// `<module>/build/outputs/mapping/<variant>/mapping.txt` files Gradle writes
+// for each build variant. When variants are given, only their mappings are
+// kept, with a warning for each variant that has none. Variants don't apply
+// to a file, which is uploaded with a warning that they're ignored.
+func resolveMappings(path string, variants []string) ([]MappingFile, error) {
+	info, err := os.Stat(path)
+	if path == "" || err != nil || !info.IsDir() {
+		module, variant := mappingVariant(path)
+		if len(variants) > 0 {
+			logger.Warnf("android_variants is ignored as proguard_mapping_path %s isn't a directory", path)
+		}
+		return []MappingFile{{Module: module, Variant: variant, Path: path}}, nil
+	}
+
+	mappings, err := discoverMappings(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, variant := range unmatchedVariants(mappings, variants) {
+		logger.Warnf("No mapping found for build variant %s in %s", variant, path)
+	}
+	if len(variants) > 0 {
+		wanted := map[string]bool{}
+		for _, variant := range variants {
+			wanted[variant] = true
+		}
+		filtered := []MappingFile{}
+		for _, mapping := range mappings {
+			if wanted[mapping.Variant] || wanted[mapping.Label()] {
+				filtered = append(filtered, mapping)
+			}
+		}
+		mappings = filtered
+	}
+	if len(mappings) == 0 {
+		return nil, &MissingArtefactError{Artefact: "Proguard mapping", Path: path}
+	}
+	return mappings, nil
+}
+
+/// Lists the variants none of the mappings belong to
+func unmatchedVariants(mappings []MappingFile, variants []string) []string {
+	unmatched := []string{}
+	for _, variant := range variants {
+		found := false
+		for _, mapping := range mappings {
+			if mapping.Variant == variant || mapping.Label() == variant {
+				found = true
+				break
+			}
+		}
+		if !found {
+			unmatched = append(unmatched, variant)
+		}
+	}
+	return unmatched
+}
+
+/// Finds every Gradle mapping.txt beneath root, sorted by path
+func discoverMappings(root string) ([]MappingFile, error) {
+	mappings := []MappingFile{}
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if skippedSearchDirs[info.Name()] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if module, variant := mappingVariant(p); variant != "" {
+			mappings = append(mappings, MappingFile{Module: module, Variant: variant, Path: p})
+		}
+		return nil
+	})
+	sort.Slice(mappings, func(i, j int) bool { return mappings[i].Path < mappings[j].Path })
+	return mappings, err
+}
+
+// mappingVariant reads the module and variant from a path shaped like
+// `<module>/build/outputs/mapping/<variant>/mapping.txt`, returning empty
+// strings for paths that aren't
+func mappingVariant(path string) (string, string) {
+	parts := strings.Split(filepath.ToSlash(filepath.Clean(path)), "/")
+	n := len(parts)
+	if n < 5 || parts[n-1] != "mapping.txt" || parts[n-3] != "mapping" || parts[n-4] != "outputs" || parts[n-5] != "build" {
+		return "", ""
+	}
+	module := ""
+	if n >= 6 {
+		module = parts[n-6]
+	}
+	return module, parts[n-2]
+}
+
+// inspectMapping checks that path looks like a Proguard / R8 mapping and
+// returns its SHA-256. Empty files are rejected, as are files whose first
+// entry isn't a `class -> obfuscated:` line, such as a usage.txt or seeds.txt
+// passed by mistake.
+func inspectMapping(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	scanner := bufio.NewScanner(io.TeeReader(f, hash))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	checked := false
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if checked || strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !mappingClassLine.MatchString(line) {
+			return "", fmt.Errorf("%s doesn't look like a Proguard mapping file, found %q", path, line)
+		}
+		checked = true
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	if !checked {
+		return "", fmt.Errorf("%s is empty", path)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// OutputMetadata is the part of the output-metadata.json Gradle writes next to
+// the APKs of each variant, under `build/outputs/apk/<variant>/`, that
+// identifies the build
+type OutputMetadata struct {
+	ApplicationID string `json:"applicationId"`
+	VariantName   string `json:"variantName"`
+	Elements      []struct {
+		VersionCode int    `json:"versionCode"`
+		VersionName string `json:"versionName"`
+	} `json:"elements"`
+}
+
+/// Reads a Gradle output-metadata.json file
+func readOutputMetadata(path string) (OutputMetadata, error) {
+	var metadata OutputMetadata
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return metadata, err
+	}
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return metadata, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	return metadata, nil
+}
+
+// AppVersion returns the applicationId along with the version of the first
+// output that has one. Split APKs of a variant all share the same version.
+func (m OutputMetadata) AppVersion() (AppVersion, error) {
+	for _, element := range m.Elements {
+		if element.VersionName == "" {
+			continue
+		}
+		version := AppVersion{ID: m.ApplicationID, Version: element.VersionName}
+		if element.VersionCode != 0 {
+			version.Build = strconv.Itoa(element.VersionCode)
+		}
+		if version.ID != "" {
+			return version, nil
+		}
+	}
+	return AppVersion{}, fmt.Errorf("no applicationId or versionName found in the output metadata of %s", m.VariantName)
+}
+
+// mappingAppVersion looks up the version of the build that produced a mapping
+// from the output-metadata.json of the same module and variant, returning
+// false when there's none
+func mappingAppVersion(mapping MappingFile) (AppVersion, bool) {
+	if mapping.Variant == "" {
+		return AppVersion{}, false
+	}
+	// <module>/build/outputs/mapping/<variant>/mapping.txt
+	outputs := filepath.Dir(filepath.Dir(filepath.Dir(mapping.Path)))
+	paths := []string{}
+	err := filepath.Walk(filepath.Join(outputs, "apk"), func(p string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() && info.Name() == "output-metadata.json" {
+			paths = append(paths, p)
+		}
+		return err
+	})
+	if err != nil {
+		return AppVersion{}, false
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		metadata, err := readOutputMetadata(path)
+		if err != nil {
+			logger.Debugf("%s", err)
+			continue
+		}
+		if metadata.VariantName != mapping.Variant {
+			continue
+		}
+		if version, err := metadata.AppVersion(); err == nil {
+			return version, true
+		}
+	}
+	return AppVersion{}, false
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"unicode/utf16"
+)
+
+// Chunk types of Android's binary XML format, see ResourceTypes.h
+const (
+	axmlStringPoolType   = 0x0001
+	axmlFileType         = 0x0003
+	axmlResourceMapType  = 0x0180
+	axmlStartElementType = 0x0102
+)
+
+// Res_value data types an attribute value can have
+const (
+	axmlTypeString = 0x03
+	axmlTypeIntDec = 0x10
+	axmlTypeIntHex = 0x11
+)
+
+/// Flag of a string pool storing UTF-8 rather than UTF-16 strings
+const axmlUTF8Flag = 1 << 8
+
+// Resource IDs of the manifest attributes, used when a shrunk manifest has
+// lost the attribute names
+var manifestAttributeIDs = map[uint32]string{
+	0x0101021b: "versionCode",
+	0x0101021c: "versionName",
+}
+
+// manifestAttributes returns the attributes of the root `<manifest>` element
+// of an APK's AndroidManifest.xml, which aapt compiles to binary XML
+func manifestAttributes(data []byte) (map[string]string, error) {
+	le := binary.LittleEndian
+	if len(data) < 8 || le.Uint16(data) != axmlFileType {
+		return nil, errors.New("not a binary XML file")
+	}
+
+	var pool []string
+	var resourceIDs []uint32
+	for offset := int(le.Uint16(data[2:])); offset+8 <= len(data); {
+		chunkType := le.Uint16(data[offset:])
+		headerSize := int(le.Uint16(data[offset+2:]))
+		size := int(le.Uint32(data[offset+4:]))
+		if size < 8 || offset+size > len(data) || headerSize > size {
+			return nil, fmt.Errorf("malformed chunk at offset %d", offset)
+		}
+		chunk := data[offset : offset+size]
+
+		switch chunkType {
+		case axmlStringPoolType:
+			var err error
+			if pool, err = axmlStringPool(chunk); err != nil {
+				return nil, err
+			}
+		case axmlResourceMapType:
+			for i := headerSize; i+4 <= size; i += 4 {
+				resourceIDs = append(resourceIDs, le.Uint32(chunk[i:]))
+			}
+		case axmlStartElementType:
+			return axmlElementAttributes(chunk, headerSize, pool, resourceIDs)
+		}
+		offset += size
+	}
+	return nil, errors.New("no manifest element found")
+}
+
+/// Decodes the strings of a string pool chunk
+func axmlStringPool(chunk []byte) ([]string, error) {
+	le := binary.LittleEndian
+	if len(chunk) < 28 {
+		return nil, errors.New("truncated string pool")
+	}
+	headerSize := int(le.Uint16(chunk[2:]))
+	count := int(le.Uint32(chunk[8:]))
+	utf8 := le.Uint32(chunk[16:])&axmlUTF8Flag != 0
+	start := int(le.Uint32(chunk[20:]))
+	if headerSize+count*4 > len(chunk) || start > len(chunk) {
+		return nil, errors.New("truncated string pool")
+	}
+
+	pool := make([]string, count)
+	for i := range pool {
+		offset := start + int(le.Uint32(chunk[headerSize+i*4:]))
+		if offset >= len(chunk) {
+			return nil, errors.New("string offset out of range")
+		}
+		s, err := axmlString(chunk[offset:], utf8)
+		if err != nil {
+			return nil, err
+		}
+		pool[i] = s
+	}
+	return pool, nil
+}
+
+// axmlString decodes a length-prefixed string pool entry. UTF-8 entries start
+// with their UTF-16 and UTF-8 lengths, UTF-16 entries with their length in
+// code units; lengths over 0x7f (0x7fff) take two units.
+func axmlString(b []byte, utf8 bool) (string, error) {
+	le := binary.LittleEndian
+	if utf8 {
+		n := 0
+		for i := 0; i < 2; i++ {
+			if n >= len(b) {
+				return "", errors.New("truncated string")
+			}
+			length := int(b[n])
+			n++
+			if length&0x80 != 0 {
+				if n >= len(b) {
+					return "", errors.New("truncated string")
+				}
+				length = (length&0x7f)<<8 | int(b[n])
+				n++
+			}
+			if i == 1 {
+				if n+length > len(b) {
+					return "", errors.New("truncated string")
+				}
+				return string(b[n : n+length]), nil
+			}
+		}
+	}
+
+	if len(b) < 2 {
+		return "", errors.New("truncated string")
+	}
+	length, n := int(le.Uint16(b)), 2
+	if length&0x8000 != 0 {
+		if len(b) < 4 {
+			return "", errors.New("truncated string")
+		}
+		length, n = (length&0x7fff)<<16|int(le.Uint16(b[2:])), 4
+	}
+	if n+length*2 > len(b) {
+		return "", errors.New("truncated string")
+	}
+	units := make([]uint16, length)
+	for i := range units {
+		units[i] = le.Uint16(b[n+i*2:])
+	}
+	return string(utf16.Decode(units)), nil
+}
+
+/// Decodes the attributes of a start element chunk
+func axmlElementAttributes(chunk []byte, headerSize int, pool []string, resourceIDs []uint32) (map[string]string, error) {
+	le := binary.LittleEndian
+	lookup := func(i uint32) string {
+		if int(i) < len(pool) {
+			return pool[i]
+		}
+		return ""
+	}
+	if headerSize+20 > len(chunk) {
+		return nil, errors.New("truncated element")
+	}
+	ext := chunk[headerSize:]
+	attributeStart := int(le.Uint16(ext[8:]))
+	attributeSize := int(le.Uint16(ext[10:]))
+	count := int(le.Uint16(ext[12:]))
+	if attributeSize < 20 || headerSize+attributeStart+count*attributeSize > len(chunk) {
+		return nil, errors.New("truncated element attributes")
+	}
+
+	attributes := map[string]string{}
+	for i := 0; i < count; i++ {
+		attr := ext[attributeStart+i*attributeSize:]
+		nameIndex := le.Uint32(attr[4:])
+		name := lookup(nameIndex)
+		if int(nameIndex) < len(resourceIDs) {
+			if known, ok := manifestAttributeIDs[resourceIDs[nameIndex]]; ok {
+				name = known
+			}
+		}
+
+		rawValue := le.Uint32(attr[8:])
+		dataType := attr[15]
+		data := le.Uint32(attr[16:])
+		switch {
+		case rawValue != 0xffffffff:
+			attributes[name] = lookup(rawValue)
+		case dataType == axmlTypeString:
+			attributes[name] = lookup(data)
+		case dataType == axmlTypeIntDec || dataType == axmlTypeIntHex:
+			attributes[name] = strconv.FormatInt(int64(int32(data)), 10)
+		}
+	}
+	return attributes, nil
+}
+
+// protoManifestAttributes returns the attributes of the root `<manifest>`
+// element of an AAB's AndroidManifest.xml, which bundletool stores as an
+// aapt2 `XmlNode` protocol buffer
+func protoManifestAttributes(data []byte) (map[string]string, error) {
+	element, err := protoField(data, 1)
+	if err != nil {
+		return nil, err
+	}
+	if element == nil {
+		return nil, errors.New("no manifest element found")
+	}
+
+	attributes := map[string]string{}
+	err = protoFields(element, func(field int, value []byte, varint uint64) error {
+		if field != 4 {
+			return nil
+		}
+		var name, text, item []byte
+		var resourceID uint64
+		err := protoFields(value, func(field int, value []byte, varint uint64) error {
+			switch field {
+			case 2:
+				name = value
+			case 3:
+				text = value
+			case 5:
+				resourceID = varint
+			case 6:
+				item = value
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		key := string(name)
+		if known, ok := manifestAttributeIDs[uint32(resourceID)]; ok {
+			key = known
+		}
+		if len(text) > 0 || item == nil {
+			attributes[key] = string(text)
+			return nil
+		}
+		// compiled `Item`, of which only `prim` (7) integers are expected
+		prim, err := protoField(item, 7)
+		if err != nil || prim == nil {
+			return err
+		}
+		return protoFields(prim, func(field int, value []byte, varint uint64) error {
+			if field == 6 || field == 7 {
+				attributes[key] = strconv.FormatInt(int64(int32(varint)), 10)
+			}
+			return nil
+		})
+	})
+	return attributes, err
+}
+
+/// Returns the first length-delimited value of field in a message, if any
+func protoField(message []byte, field int) ([]byte, error) {
+	var found []byte
+	err := protoFields(message, func(f int, value []byte, varint uint64) error {
+		if f == field && found == nil {
+			found = value
+		}
+		return nil
+	})
+	return found, err
+}
+
+// protoFields calls fn with the number of each field of a protocol buffer
+// message, passing length-delimited values as bytes and varints as integers.
+// Fixed-size fields are skipped.
+func protoFields(message []byte, fn func(field int, value []byte, varint uint64) error) error {
+	for len(message) > 0 {
+		key, n := binary.Uvarint(message)
+		if n <= 0 {
+			return errors.New("malformed protocol buffer")
+		}
+		message = message[n:]
+
+		field := int(key >> 3)
+		var value []byte
+		var varint uint64
+		switch key & 7 {
+		case 0:
+			if varint, n = binary.Uvarint(message); n <= 0 {
+				return errors.New("malformed protocol buffer")
+			}
+			message = message[n:]
+		case 1, 5:
+			size := 8
+			if key&7 == 5 {
+				size = 4
+			}
+			if len(message) < size {
+				return errors.New("malformed protocol buffer")
+			}
+			message = message[size:]
+			continue
+		case 2:
+			length, n := binary.Uvarint(message)
+			if n <= 0 || length > uint64(len(message)-n) {
+				return errors.New("malformed protocol buffer")
+			}
+			value = message[n : n+int(length)]
+			message = message[n+int(length):]
+		default:
+			return fmt.Errorf("unsupported protocol buffer wire type %d", key&7)
+		}
+		if err := fn(field, value, varint); err != nil {
+			return err
+		}
+	}
+	return nil
+}
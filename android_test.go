@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestResolveMappings(t *testing.T) {
+	t.Parallel()
+	root := t.TempDir()
+	free := filepath.Join(root, "app", "build", "outputs", "mapping", "freeRelease", "mapping.txt")
+	paid := filepath.Join(root, "app", "build", "outputs", "mapping", "paidRelease", "mapping.txt")
+	wear := filepath.Join(root, "wear", "build", "outputs", "mapping", "release", "mapping.txt")
+	usage := filepath.Join(root, "app", "build", "outputs", "mapping", "paidRelease", "usage.txt")
+	ignored := filepath.Join(root, "node_modules", "lib", "build", "outputs", "mapping", "release", "mapping.txt")
+	for _, path := range []string{free, paid, wear, usage, ignored} {
+		writeTestFile(t, path, []byte("a.b.C -> a:\n"))
+	}
+
+	var tests = []struct {
+		path     string
+		variants []string
+		expected []MappingFile
+		labels   []string
+	}{
+		{
+			path: root,
+			expected: []MappingFile{
+				{Module: "app", Variant: "freeRelease", Path: free},
+				{Module: "app", Variant: "paidRelease", Path: paid},
+				{Module: "wear", Variant: "release", Path: wear},
+			},
+			labels: []string{"freeRelease", "paidRelease", "wear:release"},
+		},
+		{
+			path:     root,
+			variants: []string{"paidRelease", "wear:release"},
+			expected: []MappingFile{
+				{Module: "app", Variant: "paidRelease", Path: paid},
+				{Module: "wear", Variant: "release", Path: wear},
+			},
+			labels: []string{"paidRelease", "wear:release"},
+		},
+		{
+			path:     free,
+			expected: []MappingFile{{Module: "app", Variant: "freeRelease", Path: free}},
+			labels:   []string{"freeRelease"},
+		},
+		{
+			path:     "path/to/mapping.txt",
+			expected: []MappingFile{{Path: "path/to/mapping.txt"}},
+			labels:   []string{""},
+		},
+	}
+
+	for _, test := range tests {
+		mappings, err := resolveMappings(test.path, test.variants)
+		if err != nil {
+			t.Errorf("Test failed: %v", err)
+		}
+		if !reflect.DeepEqual(mappings, test.expected) {
+			t.Errorf("Test failed: expected %+v but got %+v", test.expected, mappings)
+		}
+		labels := []string{}
+		for _, mapping := range mappings {
+			labels = append(labels, mapping.Label())
+		}
+		if !reflect.DeepEqual(labels, test.labels) {
+			t.Errorf("Test failed: expected labels %v but got %v", test.labels, labels)
+		}
+	}
+
+	if _, err := resolveMappings(root, []string{"debug"}); err == nil {
+		t.Errorf("Test failed: expected an error when no variant matches")
+	}
+}
+
+func TestUnmatchedVariants(t *testing.T) {
+	t.Parallel()
+	mappings := []MappingFile{
+		{Module: "app", Variant: "freeRelease"},
+		{Module: "wear", Variant: "release"},
+	}
+	var tests = []struct {
+		variants []string
+		expected []string
+	}{
+		{variants: nil, expected: []string{}},
+		{variants: []string{"freeRelease", "wear:release"}, expected: []string{}},
+		{variants: []string{"freeRelease", "paidRelase", "tv:release"}, expected: []string{"paidRelase", "tv:release"}},
+	}
+
+	for _, test := range tests {
+		if unmatched := unmatchedVariants(mappings, test.variants); !reflect.DeepEqual(unmatched, test.expected) {
+			t.Errorf("Test failed: expected unmatched variants %v but got %v", test.expected, unmatched)
+		}
+	}
+}
+
+func TestInspectMapping(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	var tests = []struct {
+		content string
+		valid   bool
+	}{
+		{content: "# compiler: R8\n# pg_map_id: 1a2b3c\ncom.example.App -> com.example.App:\n    void onCreate() -> onCreate\n", valid: true},
+		{content: "com.example.Foo -> a.a:\r\n    int bar -> a\r\n", valid: true},
+		{content: "", valid: false},
+		{content: "# compiler: R8\n\n", valid: false},
+		{content: "com.example.Unused\n    void unused()\n", valid: false},
+	}
+
+	for i, test := range tests {
+		path := filepath.Join(dir, fmt.Sprintf("mapping%d.txt", i))
+		writeTestFile(t, path, []byte(test.content))
+		checksum, err := inspectMapping(path)
+		if test.valid && (err != nil || len(checksum) != 64) {
+			t.Errorf("Test failed: expected %q to be a valid mapping but got %q, %v", test.content, checksum, err)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("Test failed: expected %q to be rejected", test.content)
+		}
+	}
+}
+
+func TestPlanMappingUploads_Duplicates(t *testing.T) {
+	t.Parallel()
+	root := t.TempDir()
+	mapping := []byte("com.example.App -> a.a:\n")
+	writeTestFile(t, filepath.Join(root, "app", "build", "outputs", "mapping", "freeRelease", "mapping.txt"), mapping)
+	writeTestFile(t, filepath.Join(root, "app", "build", "outputs", "mapping", "paidRelease", "mapping.txt"), mapping)
+	writeTestFile(t, filepath.Join(root, "app", "build", "outputs", "mapping", "proRelease", "mapping.txt"), []byte("com.example.Pro -> a.a:\n"))
+
+	jobs, err := planMappingUploads(Config{ProguardPath: root, ProjectSlug: "app", MappingMissingPolicy: missingFail})
+	if err != nil {
+		t.Fatalf("Test failed: %v", err)
+	}
+	statuses := []string{}
+	for _, job := range jobs {
+		statuses = append(statuses, job.ID+"="+job.Status)
+	}
+	expected := []string{"proguard-freeRelease=", "proguard-paidRelease=" + StatusSkipped, "proguard-proRelease="}
+	if !reflect.DeepEqual(statuses, expected) {
+		t.Errorf("Test failed: expected %v but got %v", expected, statuses)
+	}
+	if jobs[1].Reason != "identical to proguard-freeRelease" {
+		t.Errorf("Test failed: unexpected reason %q", jobs[1].Reason)
+	}
+}
+
+func TestOutputMetadata(t *testing.T) {
+	t.Parallel()
+	root := t.TempDir()
+	outputs := filepath.Join(root, "app", "build", "outputs")
+	writeTestFile(t, filepath.Join(outputs, "mapping", "freeRelease", "mapping.txt"), []byte("com.example.Free -> a.a:\n"))
+	writeTestFile(t, filepath.Join(outputs, "mapping", "paidRelease", "mapping.txt"), []byte("com.example.Paid -> a.a:\n"))
+	metadata := filepath.Join(outputs, "apk", "free", "release", "output-metadata.json")
+	writeTestFile(t, metadata, []byte(`{
+  "version": 3,
+  "artifactType": {"type": "APK", "kind": "Directory"},
+  "applicationId": "com.example.free",
+  "variantName": "freeRelease",
+  "elements": [
+    {"type": "SINGLE", "filters": [], "attributes": [], "versionCode": 120, "versionName": "1.2.0", "outputFile": "app-free-release.apk"}
+  ],
+  "elementType": "File"
+}`))
+
+	jobs, err := planMappingUploads(Config{ProguardPath: root, ProjectSlug: "app"})
+	if err != nil {
+		t.Fatalf("Test failed: %v", err)
+	}
+	expectedArgs := [][]string{{"--app-id", "com.example.free", "--version", "1.2.0", "--version-code", "120"}, nil}
+	for i, job := range jobs {
+		if !reflect.DeepEqual(job.Args, expectedArgs[i]) {
+			t.Errorf("Test failed: expected %s args %v but got %v", job.ID, expectedArgs[i], job.Args)
+		}
+	}
+
+	summary := Report{Results: []JobResult{{Job: jobs[0], Status: StatusUploaded}}}.Summary()
+	if expected := "proguard-freeRelease: uploaded for com.example.free@1.2.0+120"; summary != expected {
+		t.Errorf("Test failed: expected %q but got %q", expected, summary)
+	}
+
+	for _, cfg := range []Config{
+		{SelectedPlatform: PlatformAndroid, ProguardPath: root},
+		{SelectedPlatform: PlatformAndroid, AndroidAppPath: metadata},
+	} {
+		release, err := deriveRelease(cfg)
+		if expected := "com.example.free@1.2.0+120"; err != nil || release != expected {
+			t.Errorf("Test failed: expected %q but got %q, %v", expected, release, err)
+		}
+	}
+}
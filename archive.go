@@ -0,0 +1,203 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bitrise-io/go-utils/pathutil"
+)
+
+// Limits guarding against malformed or malicious zip archives
+const (
+	maxZipEntries = 100000
+	maxZipSize    = 8 << 30
+)
+
+/// Local file header signature every zip archive starts with
+var zipMagic = []byte("PK\x03\x04")
+
+// DsymSource holds the dSYM bundles resolved from the step inputs, along with
+// any scratch directory that has to be removed once the uploads are done.
+type DsymSource struct {
+	Paths      []string
+	scratchDir string
+}
+
+// Cleanup removes the scratch directory used to extract zipped archives
+func (s DsymSource) Cleanup() {
+	if s.scratchDir != "" {
+		if err := os.RemoveAll(s.scratchDir); err != nil {
+			logger.Warnf("failed to remove %s: %s", s.scratchDir, err)
+		}
+	}
+}
+
+// resolveDsyms turns `dsym_path`, or `archive_path` when no dSYM path is
+// set, into the list of paths to pass to `upload-dif`. An .xcarchive is
+// searched for its dSYMs (including those of embedded frameworks), and any
+// zip file (.ipa, .zip, .dSYM.zip) is extracted first. Any other path is
+// passed on unchanged.
+func resolveDsyms(cfg Config) (DsymSource, error) {
+	path := cfg.DsymPath
+	if path == "" {
+		path = cfg.ArchivePath
+	}
+	source := DsymSource{Paths: []string{path}}
+
+	if strings.EqualFold(filepath.Ext(path), ".xcarchive") {
+		dsyms, err := findDsyms(path)
+		if err != nil {
+			return source, err
+		}
+		source.Paths = dsyms
+		return source, nil
+	}
+
+	isZip, err := isZipFile(path)
+	if err != nil || !isZip {
+		return source, err
+	}
+	dir, err := pathutil.NormalizedOSTempDirPath("sentry-upload")
+	if err != nil {
+		return source, err
+	}
+	source.scratchDir = dir
+	logger.Printf("Extracting %s...", path)
+	if err := extractZip(path, dir, defaultZipLimits); err != nil {
+		return source, fmt.Errorf("failed to extract %s: %v", path, err)
+	}
+	dsyms, err := findDsyms(dir)
+	if err != nil {
+		return source, err
+	}
+	source.Paths = dsyms
+	return source, nil
+}
+
+/// Finds every .dSYM bundle beneath root
+func findDsyms(root string) ([]string, error) {
+	dsyms := []string{}
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && strings.EqualFold(filepath.Ext(p), ".dSYM") {
+			dsyms = append(dsyms, p)
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(dsyms) == 0 {
+		return nil, &MissingArtefactError{Artefact: "dSYM", Path: root}
+	}
+	sort.Strings(dsyms)
+	return dsyms, nil
+}
+
+/// Reports whether path is a regular file starting with the zip signature
+func isZipFile(path string) (bool, error) {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil || info.IsDir() {
+		return false, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	header := make([]byte, len(zipMagic))
+	if _, err := io.ReadFull(f, header); err != nil {
+		return false, nil
+	}
+	return bytes.Equal(header, zipMagic), nil
+}
+
+// zipLimits bounds the number of entries and total uncompressed size of an
+// archive
+type zipLimits struct {
+	entries int
+	size    uint64
+}
+
+/// Limits applied to the zipped archives passed as inputs
+var defaultZipLimits = zipLimits{entries: maxZipEntries, size: maxZipSize}
+
+// extractZip extracts src into dest, refusing archives with too many entries,
+// a total uncompressed size over the limit, entries expanding to more than
+// their declared size or entries escaping dest.
+func extractZip(src, dest string, limits zipLimits) error {
+	r, err := zip.OpenReader(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	if len(r.File) > limits.entries {
+		return fmt.Errorf("archive has %d entries, more than the limit of %d", len(r.File), limits.entries)
+	}
+	var total uint64
+	for _, f := range r.File {
+		total += f.UncompressedSize64
+		if total > limits.size {
+			return fmt.Errorf("archive expands to more than %d bytes", limits.size)
+		}
+	}
+
+	for _, f := range r.File {
+		path := filepath.Join(dest, f.Name)
+		if path != filepath.Clean(dest) && !strings.HasPrefix(path, filepath.Clean(dest)+string(os.PathSeparator)) {
+			return fmt.Errorf("illegal entry path: %s", f.Name)
+		}
+		if f.FileInfo().IsDir() {
+			if err := os.MkdirAll(path, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := extractZipEntry(f, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extractZipEntry writes a single zip entry to path, reading no more than its
+// declared size, so the total checked by extractZip holds
+func extractZipEntry(f *zip.File, path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(out, io.LimitReader(rc, int64(f.UncompressedSize64)+1))
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	// archive/zip itself fails with ErrFormat once an entry outgrows its size
+	if err == zip.ErrFormat || uint64(n) > f.UncompressedSize64 {
+		return fmt.Errorf("archive entry %s expands to more than its declared size", f.Name)
+	}
+	return err
+}
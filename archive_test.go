@@ -0,0 +1,165 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+/// Writes a zip archive containing the given entries and their contents
+func writeTestZip(t *testing.T, path string, entries map[string][]byte) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for name := range entries {
+		names = append(names, name)
+	}
+	// parent directories sort before their contents
+	sort.Strings(names)
+
+	w := zip.NewWriter(f)
+	for _, name := range names {
+		entry, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := entry.Write(entries[name]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResolveDsyms_Xcarchive(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "App.xcarchive")
+	app := filepath.Join(archive, "dSYMs", "App.app.dSYM")
+	framework := filepath.Join(archive, "dSYMs", "Kit.framework.dSYM")
+	writeTestFile(t, filepath.Join(app, "Contents", "Resources", "DWARF", "App"), testMachO(appUUID))
+	writeTestFile(t, filepath.Join(framework, "Contents", "Resources", "DWARF", "Kit"), testMachO(staleUUID))
+
+	source, err := resolveDsyms(Config{ArchivePath: archive})
+	defer source.Cleanup()
+	if err != nil {
+		t.Fatalf("Test failed: %v", err)
+	}
+	expected := []string{app, framework}
+	if !reflect.DeepEqual(source.Paths, expected) {
+		t.Errorf("Test failed: expected %v but got %v", expected, source.Paths)
+	}
+}
+
+func TestResolveDsyms_Zip(t *testing.T) {
+	dir := t.TempDir()
+	// deploy dirs don't always keep the extension, so zips are sniffed
+	path := filepath.Join(dir, "App.dSYM.zip.download")
+	writeTestZip(t, path, map[string][]byte{
+		"Payload/":                                          nil,
+		"Payload/App.app.dSYM/":                             nil,
+		"Payload/App.app.dSYM/Contents/":                    nil,
+		"Payload/App.app.dSYM/Contents/Resources/":          nil,
+		"Payload/App.app.dSYM/Contents/Resources/DWARF/":    nil,
+		"Payload/App.app.dSYM/Contents/Resources/DWARF/App": testMachO(appUUID),
+	})
+
+	source, err := resolveDsyms(Config{DsymPath: path})
+	if err != nil {
+		t.Fatalf("Test failed: %v", err)
+	}
+	if len(source.Paths) != 1 || filepath.Base(source.Paths[0]) != "App.app.dSYM" {
+		t.Errorf("Test failed: expected a single extracted dSYM but got %v", source.Paths)
+	}
+
+	source.Cleanup()
+	if _, err := os.Stat(source.Paths[0]); !os.IsNotExist(err) {
+		t.Errorf("Test failed: expected %s to be removed", source.Paths[0])
+	}
+}
+
+func TestExtractZip_IllegalPath(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "evil.zip")
+	writeTestZip(t, path, map[string][]byte{
+		"../escaped.txt": []byte("nope"),
+	})
+
+	dest := filepath.Join(dir, "out")
+	if err := extractZip(path, dest, defaultZipLimits); err == nil {
+		t.Errorf("Test failed: expected an error for an entry escaping %s", dest)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "escaped.txt")); !os.IsNotExist(err) {
+		t.Errorf("Test failed: entry was written outside of %s", dest)
+	}
+}
+
+func TestExtractZip_Limits(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "App.dSYM.zip")
+	writeTestZip(t, path, map[string][]byte{
+		"a.txt": []byte("0123456789"),
+		"b.txt": []byte("0123456789"),
+		"c.txt": []byte("0123456789"),
+	})
+
+	var tests = []struct {
+		limits zipLimits
+		err    string
+	}{
+		{limits: zipLimits{entries: 2, size: 100}, err: "archive has 3 entries, more than the limit of 2"},
+		{limits: zipLimits{entries: 3, size: 25}, err: "archive expands to more than 25 bytes"},
+		{limits: zipLimits{entries: 3, size: 30}},
+	}
+
+	for i, test := range tests {
+		err := extractZip(path, filepath.Join(dir, fmt.Sprintf("out%d", i)), test.limits)
+		if test.err == "" && err != nil {
+			t.Errorf("Test failed: %v", err)
+		}
+		if test.err != "" && (err == nil || err.Error() != test.err) {
+			t.Errorf("Test failed: expected %q but got %v", test.err, err)
+		}
+	}
+}
+
+func TestExtractZip_UndeclaredSize(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "App.dSYM.zip")
+	writeTestZip(t, path, map[string][]byte{
+		"a.txt": []byte("0123456789"),
+	})
+
+	// shrink the size the central directory declares for the entry
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := bytes.Index(data, []byte("PK\x01\x02"))
+	if header < 0 {
+		t.Fatal("no central directory header")
+	}
+	binary.LittleEndian.PutUint32(data[header+24:], 4)
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err = extractZip(path, filepath.Join(dir, "out"), defaultZipLimits)
+	if err == nil || !strings.Contains(err.Error(), "expands to more than its declared size") {
+		t.Errorf("Test failed: expected an undeclared size error but got %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+/// Matches the host and `owner/name` path of SSH and HTTPS git remote URLs
+var repoURLPattern = regexp.MustCompile(`^(?:[a-z+]+://)?(?:[^@/]+@)?([^:/]+)(?::\d+)?[:/](.+?)(?:\.git)?/?$`)
+
+// vcsProviders maps git hosts to the provider names Sentry knows them by
+var vcsProviders = map[string]string{
+	"github.com":    "github",
+	"gitlab.com":    "gitlab",
+	"bitbucket.org": "bitbucket",
+}
+
+// planArtefactUploads plans one `build upload` job per path of
+// `artefact_paths`. Artefacts go to the iOS or Android projects depending on
+// their type, along with the build configuration and the VCS metadata of the
+// build. Artefacts of the platform not selected are left out, and planning
+// fails when cli is too old to upload the others.
+func planArtefactUploads(cfg Config, cli SentryCli) ([]UploadJob, error) {
+	paths := splitList(cfg.ArtefactPaths)
+	jobs := []UploadJob{}
+	for _, path := range paths {
+		var platform Platform
+		var projects []string
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".ipa", ".xcarchive":
+			platform, projects = PlatformIOS, cfg.iOSProjects()
+		case ".apk", ".aab":
+			platform, projects = PlatformAndroid, cfg.androidProjects()
+		default:
+			return nil, fmt.Errorf("unsupported build artefact %s, expected an .ipa, .xcarchive, .apk or .aab", path)
+		}
+		if cfg.SelectedPlatform != PlatformBoth && cfg.SelectedPlatform != platform {
+			logger.Printf("Not uploading %s, platform is %s", path, cfg.SelectedPlatform)
+			continue
+		}
+		if err := checkCommandSupported(buildUploadCmd, cli.Version); err != nil {
+			return nil, err
+		}
+		if len(projects) == 0 {
+			return nil, fmt.Errorf("no project to upload %s to", path)
+		}
+		if err := checkArtefactsExist("build artefact", []string{path}); err != nil {
+			return nil, err
+		}
+
+		job := UploadJob{
+			ID:       "build",
+			Command:  buildUploadCmd,
+			Args:     buildUploadArgs(cfg),
+			Files:    []string{path},
+			Projects: projects,
+		}
+		if len(paths) > 1 {
+			job.ID += "-" + filepath.Base(path)
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// buildUploadArgs passes the build configuration and whatever VCS metadata is
+// known to `build upload`, which Sentry uses to compare builds across commits
+// and pull requests
+func buildUploadArgs(cfg Config) []string {
+	args := []string{}
+	add := func(name, value string) {
+		if value != "" {
+			args = append(args, name, value)
+		}
+	}
+	add("--build-configuration", cfg.BuildConfiguration)
+	add("--head-sha", cfg.VCSHeadSha)
+	if provider, repo := parseRepoURL(cfg.VCSRepoURL); repo != "" {
+		add("--vcs-provider", provider)
+		add("--head-repo-name", repo)
+	}
+	add("--head-ref", cfg.VCSHeadRef)
+	add("--base-ref", cfg.VCSBaseRef)
+	add("--pr-number", cfg.VCSPRNumber)
+	return args
+}
+
+// parseRepoURL returns the provider and `owner/name` of a git remote URL such
+// as `git@github.com:owner/name.git`. The provider is empty for hosts other
+// than the known hosted services.
+func parseRepoURL(url string) (string, string) {
+	match := repoURLPattern.FindStringSubmatch(strings.TrimSpace(url))
+	if match == nil {
+		return "", ""
+	}
+	return vcsProviders[strings.ToLower(match[1])], match[2]
+}
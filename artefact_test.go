@@ -0,0 +1,111 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseRepoURL(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		url      string
+		provider string
+		repo     string
+	}{
+		{url: "git@github.com:example/app.git", provider: "github", repo: "example/app"},
+		{url: "https://github.com/example/app.git", provider: "github", repo: "example/app"},
+		{url: "https://token@gitlab.com/group/sub/app", provider: "gitlab", repo: "group/sub/app"},
+		{url: "ssh://git@bitbucket.org:22/example/app.git", provider: "bitbucket", repo: "example/app"},
+		{url: "git@git.example.com:mobile/app.git", provider: "", repo: "mobile/app"},
+		{url: "", provider: "", repo: ""},
+	}
+
+	for _, test := range tests {
+		provider, repo := parseRepoURL(test.url)
+		if provider != test.provider || repo != test.repo {
+			t.Errorf("Test failed: expected %q, %q for %q but got %q, %q", test.provider, test.repo, test.url, provider, repo)
+		}
+	}
+}
+
+func TestPlanArtefactUploads(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	ipa := filepath.Join(dir, "App.ipa")
+	aab := filepath.Join(dir, "app-release.aab")
+	writeTestFile(t, ipa, []byte("ipa"))
+	writeTestFile(t, aab, []byte("aab"))
+
+	cfg := Config{
+		SelectedPlatform:   PlatformBoth,
+		IosProjectSlug:     "ios-app",
+		AndroidProjectSlug: "android-app",
+		ArtefactPaths:      ipa + "|" + aab,
+		BuildConfiguration: "Release",
+		VCSHeadSha:         "0123abcd",
+		VCSHeadRef:         "feature/size",
+		VCSBaseRef:         "main",
+		VCSRepoURL:         "git@github.com:example/app.git",
+		VCSPRNumber:        "42",
+	}
+	cli := SentryCli{Path: sentryCli, Version: Version{2, 52, 0}}
+	jobs, err := planArtefactUploads(cfg, cli)
+	if err != nil {
+		t.Fatalf("Test failed: %v", err)
+	}
+	args := []string{
+		"--build-configuration", "Release",
+		"--head-sha", "0123abcd",
+		"--vcs-provider", "github",
+		"--head-repo-name", "example/app",
+		"--head-ref", "feature/size",
+		"--base-ref", "main",
+		"--pr-number", "42",
+	}
+	expected := []UploadJob{
+		{ID: "build-App.ipa", Command: buildUploadCmd, Args: args, Files: []string{ipa}, Projects: []string{"ios-app"}},
+		{ID: "build-app-release.aab", Command: buildUploadCmd, Args: args, Files: []string{aab}, Projects: []string{"android-app"}},
+	}
+	if !reflect.DeepEqual(jobs, expected) {
+		t.Errorf("Test failed: expected %+v but got %+v", expected, jobs)
+	}
+
+	cfg.SelectedPlatform = PlatformIOS
+	if jobs, err := planArtefactUploads(cfg, cli); err != nil || !reflect.DeepEqual(jobs, expected[:1]) {
+		t.Errorf("Test failed: expected only the iOS artefact %+v but got %+v, %v", expected[:1], jobs, err)
+	}
+
+	_, err = planArtefactUploads(cfg, testCli)
+	if err == nil || !strings.Contains(err.Error(), "2.52.0 or later is required") {
+		t.Errorf("Test failed: expected an old sentry-cli to fail the plan but got %v", err)
+	}
+
+	cfg.ArtefactPaths = filepath.Join(dir, "missing.ipa")
+	if _, err := planArtefactUploads(cfg, cli); err == nil {
+		t.Error("Test failed: expected a missing artefact to fail the plan")
+	}
+}
+
+func TestRunJob_UnsupportedCommand(t *testing.T) {
+	t.Parallel()
+	job := UploadJob{ID: "build", Command: buildUploadCmd, Files: []string{"App.ipa"}}
+	cmd := respondWith("Success\n")
+
+	_, err := runJob(testConfig, testCli, job, cmd)
+	if err == nil || !strings.Contains(err.Error(), "2.52.0 or later is required") {
+		t.Errorf("Test failed: expected an unsupported command error but got %v", err)
+	}
+	if calls := cmd.Calls(); len(calls) != 0 {
+		t.Errorf("Test failed: expected no sentry-cli calls but got %+v", calls)
+	}
+
+	cli := SentryCli{Path: sentryCli, Version: Version{2, 52, 0}}
+	if _, err := runJob(testConfig, cli, job, cmd); err != nil {
+		t.Errorf("Test failed: %v", err)
+	}
+	if calls := cmd.Calls(); len(calls) != 1 || !strings.Contains(strings.Join(calls[0].Args, " "), "build upload") {
+		t.Errorf("Test failed: expected a build upload but got %+v", calls)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// cliDefaults mirrors the input defaults from step.yml, which Bitrise would
+// otherwise provide, for inputs left unset when running from the command line
+var cliDefaults = map[string]string{
+	"platform":                 string(PlatformBoth),
+	"is_debug_mode":            "false",
+	"dsym_uuid_check":          uuidCheckOff,
+	"sentry_cli_install_dir":   "$HOME/.sentry-upload/bin",
+	"dsym_missing_policy":      missingFail,
+	"mapping_missing_policy":   missingFail,
+	"deploy_url":               "$BITRISE_BUILD_URL",
+	"vcs_head_sha":             "$BITRISE_GIT_COMMIT",
+	"vcs_head_ref":             "$BITRISE_GIT_BRANCH",
+	"vcs_base_ref":             "$BITRISEIO_GIT_BRANCH_DEST",
+	"vcs_repo_url":             "$GIT_REPOSITORY_URL",
+	"vcs_pr_number":            "$BITRISE_PULL_REQUEST",
+	"insecure_skip_tls_verify": "false",
+	"skip_token_check":         "false",
+}
+
+// applyCLIArgs lets the step run as a standalone tool. Every Config input is
+// available as a flag named after its env key (`--dsym-path` for
+// `dsym_path`), and `--env-file` loads `KEY=VALUE` lines. Both are exported to
+// the environment, flags taking precedence, so stepconf.Parse populates Config
+// exactly as it does on Bitrise. Returns flag.ErrHelp for `--help`.
+func applyCLIArgs(args []string, output io.Writer) error {
+	fs := flag.NewFlagSet("bitrise-step-sentry-upload", flag.ContinueOnError)
+	fs.SetOutput(output)
+	envFile := fs.String("env-file", "", "load inputs from a file of KEY=VALUE lines")
+
+	flagKeys := map[string]string{}
+	t := reflect.TypeOf(Config{})
+	for i := 0; i < t.NumField(); i++ {
+		tag, ok := t.Field(i).Tag.Lookup("env")
+		if !ok {
+			continue
+		}
+		key, constraint := parseEnvTag(tag)
+		name := strings.Replace(key, "_", "-", -1)
+		usage := fmt.Sprintf("sets the %s input", key)
+		if strings.HasPrefix(constraint, "opt[") {
+			usage += fmt.Sprintf(", one of: %s", strings.Replace(constraint[4:len(constraint)-1], ",", ", ", -1))
+		}
+		flagKeys[name] = key
+		fs.String(name, cliDefaults[key], usage)
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(output, "Usage: %s [flags]\n\nUploads iOS and Android symbols to Sentry.\n\n", fs.Name())
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected argument: %s", fs.Arg(0))
+	}
+
+	if *envFile != "" {
+		if err := loadEnvFile(*envFile); err != nil {
+			return fmt.Errorf("failed to load %s: %v", *envFile, err)
+		}
+	}
+	var err error
+	fs.Visit(func(f *flag.Flag) {
+		if key, ok := flagKeys[f.Name]; ok && err == nil {
+			err = os.Setenv(key, f.Value.String())
+		}
+	})
+	if err != nil {
+		return err
+	}
+	for key, value := range cliDefaults {
+		if _, ok := os.LookupEnv(key); !ok {
+			if err := os.Setenv(key, os.ExpandEnv(value)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+/// Splits a Config `env` tag into its key and constraint
+func parseEnvTag(tag string) (string, string) {
+	parts := strings.SplitN(tag, ",", 2)
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+	return parts[0], parts[1]
+}
+
+// loadEnvFile exports the `KEY=VALUE` lines of a dotenv-style file, skipping
+// blank lines and comments and allowing an `export ` prefix and quoted values
+func loadEnvFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		sep := strings.Index(line, "=")
+		if sep <= 0 {
+			return fmt.Errorf("line %d: expected KEY=VALUE", n)
+		}
+		key := strings.TrimSpace(line[:sep])
+		value := strings.TrimSpace(line[sep+1:])
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		if err := os.Setenv(key, value); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
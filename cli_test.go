@@ -0,0 +1,107 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/bitrise-io/go-steputils/stepconf"
+)
+
+func TestApplyCLIArgs(t *testing.T) {
+	envFile := filepath.Join(t.TempDir(), "ci.env")
+	writeTestFile(t, envFile, []byte(`# copied from the CI build
+export auth_token="from-env-file"
+org_slug=env-org
+project_slug='env-project'
+`))
+
+	keys := []string{"auth_token", "org_slug", "project_slug", "proguard_mapping_path"}
+	for key := range cliDefaults {
+		keys = append(keys, key)
+	}
+	for _, key := range keys {
+		os.Unsetenv(key)
+	}
+	defer func() {
+		for _, key := range keys {
+			os.Unsetenv(key)
+		}
+	}()
+
+	args := []string{"--env-file", envFile, "--platform", "android", "--org-slug", "flag-org", "--proguard-mapping-path", "mapping.txt"}
+	if err := applyCLIArgs(args, ioutil.Discard); err != nil {
+		t.Fatalf("Test failed: %v", err)
+	}
+	var cfg Config
+	if err := stepconf.Parse(&cfg); err != nil {
+		t.Fatalf("Test failed: %v", err)
+	}
+
+	expected := Config{
+		SelectedPlatform:     PlatformAndroid,
+		DsymUUIDCheck:        uuidCheckOff,
+		SentryCliInstallDir:  os.ExpandEnv(cliDefaults["sentry_cli_install_dir"]),
+		DsymMissingPolicy:    missingFail,
+		MappingMissingPolicy: missingFail,
+		AuthToken:            "from-env-file",
+		OrgSlug:              "flag-org",
+		ProjectSlug:          "env-project",
+		ProguardPath:         "mapping.txt",
+		// set on Bitrise, empty elsewhere
+		DeployURL:   os.ExpandEnv(cliDefaults["deploy_url"]),
+		VCSHeadSha:  os.ExpandEnv(cliDefaults["vcs_head_sha"]),
+		VCSHeadRef:  os.ExpandEnv(cliDefaults["vcs_head_ref"]),
+		VCSBaseRef:  os.ExpandEnv(cliDefaults["vcs_base_ref"]),
+		VCSRepoURL:  os.ExpandEnv(cliDefaults["vcs_repo_url"]),
+		VCSPRNumber: os.ExpandEnv(cliDefaults["vcs_pr_number"]),
+	}
+	if !reflect.DeepEqual(cfg, expected) {
+		t.Errorf("Test failed: expected %+v but got %+v", expected, cfg)
+	}
+}
+
+func TestApplyCLIArgs_Help(t *testing.T) {
+	if err := applyCLIArgs([]string{"--help"}, ioutil.Discard); err != flag.ErrHelp {
+		t.Errorf("Test failed: expected flag.ErrHelp but got %v", err)
+	}
+	if err := applyCLIArgs([]string{"--no-such-input", "x"}, ioutil.Discard); err == nil {
+		t.Errorf("Test failed: expected an error for an unknown flag")
+	}
+}
+
+/// Matches an input of step.yml along with its default value
+var stepInputPattern = regexp.MustCompile(`^  - (\w+):\s*(.*)$`)
+
+func TestCLIDefaultsMatchStepYML(t *testing.T) {
+	t.Parallel()
+	data, err := ioutil.ReadFile("step.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defaults := map[string]string{}
+	inInputs := false
+	for _, line := range strings.Split(string(data), "\n") {
+		// Windows checkouts may have CRLF line endings
+		line = strings.TrimSuffix(line, "\r")
+		switch {
+		case line == "inputs:":
+			inInputs = true
+		case !strings.HasPrefix(line, " ") && strings.HasSuffix(line, ":"):
+			inInputs = false
+		case inInputs:
+			if match := stepInputPattern.FindStringSubmatch(line); match != nil && match[2] != "" {
+				defaults[match[1]] = strings.Trim(match[2], `"'`)
+			}
+		}
+	}
+
+	if !reflect.DeepEqual(cliDefaults, defaults) {
+		t.Errorf("Test failed: cliDefaults %v don't match the step.yml input defaults %v", cliDefaults, defaults)
+	}
+}
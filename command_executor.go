@@ -1,16 +1,47 @@
 package main
 
-import "os/exec"
+import (
+	"os"
+	"os/exec"
+)
+
+// Invocation describes a single command to run: the executable, its
+// arguments, extra `KEY=VALUE` environment variables and working directory.
+// StdoutOnly keeps stderr out of the output of successful commands.
+type Invocation struct {
+	Command    string
+	Args       []string
+	Env        []string
+	Dir        string
+	StdoutOnly bool
+}
+
+/// Builds an Invocation running command with args in the current directory
+func newInvocation(command string, args ...string) Invocation {
+	return Invocation{Command: command, Args: args}
+}
 
 // CommandExecutor interface to allow mocking `exec.Command` within tests
 type CommandExecutor interface {
-	execute(string, ...string) ([]byte, error)
+	execute(Invocation) ([]byte, error)
 }
 
 // StepExecutor implementation that Bitrise will use
 type StepExecutor struct{}
 
 /// Execute a console command
-func (c StepExecutor) execute(command string, args ...string) ([]byte, error) {
-	return exec.Command(command, args...).CombinedOutput()
+func (c StepExecutor) execute(inv Invocation) ([]byte, error) {
+	cmd := exec.Command(inv.Command, inv.Args...)
+	cmd.Dir = inv.Dir
+	if len(inv.Env) > 0 {
+		cmd.Env = append(os.Environ(), inv.Env...)
+	}
+	if inv.StdoutOnly {
+		out, err := cmd.Output()
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return exitErr.Stderr, err
+		}
+		return out, err
+	}
+	return cmd.CombinedOutput()
 }
@@ -0,0 +1,55 @@
+package main
+
+import "sync"
+
+// ScriptedResponse is the output and error returned for one execution
+type ScriptedResponse struct {
+	ret []byte
+	err error
+}
+
+// RecordingExecutor to mock command execution in tests. It captures every
+// invocation and replies with its scripted responses in order, repeating the
+// last one once they run out.
+type RecordingExecutor struct {
+	mu        sync.Mutex
+	responses []ScriptedResponse
+	calls     []Invocation
+}
+
+/// Creates a RecordingExecutor replying with the given responses in order
+func newRecordingExecutor(responses ...ScriptedResponse) *RecordingExecutor {
+	return &RecordingExecutor{responses: responses}
+}
+
+/// Creates a RecordingExecutor whose commands all succeed with output
+func respondWith(output string) *RecordingExecutor {
+	return newRecordingExecutor(ScriptedResponse{ret: []byte(output)})
+}
+
+/// Creates a RecordingExecutor whose commands all fail with output and err
+func failWith(output string, err error) *RecordingExecutor {
+	return newRecordingExecutor(ScriptedResponse{ret: []byte(output), err: err})
+}
+
+func (e *RecordingExecutor) execute(inv Invocation) ([]byte, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.calls = append(e.calls, inv)
+	if len(e.responses) == 0 {
+		return nil, nil
+	}
+	response := e.responses[0]
+	if len(e.responses) > 1 {
+		e.responses = e.responses[1:]
+	}
+	return response.ret, response.err
+}
+
+// Calls returns a copy of the invocations captured so far
+func (e *RecordingExecutor) Calls() []Invocation {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]Invocation{}, e.calls...)
+}
@@ -1,15 +1,96 @@
 package main
 
+import (
+	"strings"
+
+	"github.com/bitrise-io/go-steputils/stepconf"
+)
+
+// Platform selects which platforms' symbols are uploaded
+type Platform string
+
+// Platforms accepted by the `platform` input
+const (
+	PlatformBoth    Platform = "both"
+	PlatformIOS     Platform = "ios"
+	PlatformAndroid Platform = "android"
+)
+
 // Config will be populated with the retrieved values from environment variables
 // configured as step inputs.
 type Config struct {
 	// Bitrise environment inputs
-	SelectedPlatform string `env:"platform"`
-	IsDebugMode      string `env:"is_debug_mode"`
-	AuthToken        string `env:"auth_token"`
-	SentryURL        string `env:"sentry_url"`
-	OrgSlug          string `env:"org_slug"`
-	ProjectSlug      string `env:"project_slug"`
-	DsymPath         string `env:"dsym_path"`
-	ProguardPath     string `env:"proguard_mapping_path"`
+	SelectedPlatform     Platform `env:"platform,opt[both,ios,android]"`
+	IsDebugMode          bool     `env:"is_debug_mode,opt[true,false]"`
+	AuthTokenFile        string   `env:"auth_token_file"`
+	AuthTokenCommand     string   `env:"auth_token_command"`
+	SentryURL            string   `env:"sentry_url"`
+	OrgSlug              string   `env:"org_slug"`
+	ProjectSlug          string   `env:"project_slug"`
+	IosProjectSlug       string   `env:"ios_project_slug"`
+	AndroidProjectSlug   string   `env:"android_project_slug"`
+	DsymPath             string   `env:"dsym_path"`
+	ProguardPath         string   `env:"proguard_mapping_path"`
+	AndroidVariants      string   `env:"android_variants"`
+	ArchivePath          string   `env:"archive_path"`
+	AndroidAppPath       string   `env:"android_app_path"`
+	DsymUUIDCheck        string   `env:"dsym_uuid_check,opt[off,warn,fail]"`
+	SentryCliPath        string   `env:"sentry_cli_path"`
+	SentryCliInstallDir  string   `env:"sentry_cli_install_dir"`
+	SentryConfigPath     string   `env:"sentry_config_path"`
+	DsymMissingPolicy    string   `env:"dsym_missing_policy,opt[fail,warn,skip]"`
+	MappingMissingPolicy string   `env:"mapping_missing_policy,opt[fail,warn,skip]"`
+	Release              string   `env:"release"`
+	DeployEnvironment    string   `env:"deploy_environment"`
+	DeployName           string   `env:"deploy_name"`
+	DeployURL            string   `env:"deploy_url"`
+	ArtefactPaths        string   `env:"artefact_paths"`
+	BuildConfiguration   string   `env:"build_configuration"`
+	VCSHeadSha           string   `env:"vcs_head_sha"`
+	VCSHeadRef           string   `env:"vcs_head_ref"`
+	VCSBaseRef           string   `env:"vcs_base_ref"`
+	VCSRepoURL           string   `env:"vcs_repo_url"`
+	VCSPRNumber          string   `env:"vcs_pr_number"`
+	VerificationDSN      string   `env:"verification_dsn"`
+	NoProxyHosts         string   `env:"no_proxy_hosts"`
+	CABundlePath         string   `env:"ca_bundle_path"`
+	SkipTLSVerify        bool     `env:"insecure_skip_tls_verify,opt[true,false]"`
+	SkipTokenCheck       bool     `env:"skip_token_check,opt[true,false]"`
+
+	// Passed through to sentry-cli, printed with sensitive values masked
+	AuthToken     stepconf.Secret `env:"auth_token"`
+	ProxyURL      MaskedURL       `env:"proxy_url"`
+	CustomHeaders HeaderList      `env:"custom_headers"`
+	SentryCliEnv  EnvList         `env:"sentry_cli_env"`
+}
+
+// iOSProjects returns the Sentry projects dSYMs are uploaded to
+func (cfg Config) iOSProjects() []string {
+	return projectList(cfg.IosProjectSlug, cfg.ProjectSlug)
+}
+
+// androidProjects returns the Sentry projects mappings are uploaded to
+func (cfg Config) androidProjects() []string {
+	return projectList(cfg.AndroidProjectSlug, cfg.ProjectSlug)
+}
+
+/// Splits the platform's project slugs, falling back to the shared ones
+func projectList(platformSlugs, fallback string) []string {
+	if projects := splitList(platformSlugs); len(projects) > 0 {
+		return projects
+	}
+	return splitList(fallback)
+}
+
+/// Splits an input holding several values separated by `|`, `,` or newlines
+func splitList(value string) []string {
+	items := []string{}
+	for _, item := range strings.FieldsFunc(value, func(r rune) bool {
+		return r == '|' || r == ',' || r == '\n'
+	}) {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
 }
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"debug/macho"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+/// Mach-O load command holding the binary's UUID
+const lcUUID = 0x1b
+
+/// Largest app executable read into memory from an .ipa
+const maxIpaExecutableSize = 512 << 20
+
+// dSYM UUID check modes for the `dsym_uuid_check` input
+const (
+	uuidCheckOff  = "off"
+	uuidCheckWarn = "warn"
+	uuidCheckFail = "fail"
+)
+
+// machoUUIDs returns the UUID of every architecture slice of a Mach-O file,
+// handling both thin and universal (fat) binaries.
+func machoUUIDs(r io.ReaderAt) ([]string, error) {
+	var files []*macho.File
+	fat, err := macho.NewFatFile(r)
+	if err == nil {
+		defer fat.Close()
+		for _, arch := range fat.Arches {
+			files = append(files, arch.File)
+		}
+	} else if err == macho.ErrNotFat {
+		f, err := macho.NewFile(r)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		files = append(files, f)
+	} else {
+		return nil, err
+	}
+
+	uuids := []string{}
+	for _, f := range files {
+		for _, load := range f.Loads {
+			raw := load.Raw()
+			if len(raw) < 24 || f.ByteOrder.Uint32(raw[0:4]) != lcUUID {
+				continue
+			}
+			uuids = append(uuids, formatUUID(raw[8:24]))
+		}
+	}
+	return uuids, nil
+}
+
+/// Formats raw UUID bytes the same way `dwarfdump --uuid` does
+func formatUUID(b []byte) string {
+	return strings.ToUpper(fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]))
+}
+
+// dsymUUIDs collects the UUIDs of every DWARF binary found at path, which can
+// be a single .dSYM bundle or a directory containing several.
+func dsymUUIDs(path string) (map[string]bool, error) {
+	uuids := map[string]bool{}
+	err := filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || filepath.Base(filepath.Dir(p)) != "DWARF" {
+			return nil
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		found, err := machoUUIDs(f)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %v", p, err)
+		}
+		for _, uuid := range found {
+			uuids[uuid] = true
+		}
+		return nil
+	})
+	return uuids, err
+}
+
+// appExecutableUUIDs returns the UUIDs of the main app executable inside an
+// .xcarchive, an .ipa or a bare .app bundle.
+func appExecutableUUIDs(archivePath string) ([]string, error) {
+	switch strings.ToLower(filepath.Ext(archivePath)) {
+	case ".ipa":
+		return ipaExecutableUUIDs(archivePath)
+	case ".xcarchive":
+		apps, err := filepath.Glob(filepath.Join(archivePath, "Products", "Applications", "*.app"))
+		if err != nil {
+			return nil, err
+		}
+		if len(apps) == 0 {
+			return nil, fmt.Errorf("no .app found in %s", archivePath)
+		}
+		return appBundleUUIDs(apps[0])
+	case ".app":
+		return appBundleUUIDs(archivePath)
+	}
+	return nil, fmt.Errorf("unsupported archive type: %s", archivePath)
+}
+
+/// Reads the executable of an .app bundle, which shares the bundle's name
+func appBundleUUIDs(appPath string) ([]string, error) {
+	name := strings.TrimSuffix(filepath.Base(appPath), filepath.Ext(appPath))
+	f, err := os.Open(filepath.Join(appPath, name))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return machoUUIDs(f)
+}
+
+/// Reads the executable from `Payload/<name>.app/<name>` inside an .ipa
+func ipaExecutableUUIDs(ipaPath string) ([]string, error) {
+	r, err := zip.OpenReader(ipaPath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	for _, f := range r.File {
+		parts := strings.Split(f.Name, "/")
+		if len(parts) != 3 || parts[0] != "Payload" || parts[2] != strings.TrimSuffix(parts[1], ".app") {
+			continue
+		}
+		if f.UncompressedSize64 > maxIpaExecutableSize {
+			return nil, fmt.Errorf("executable %s is too large to inspect", f.Name)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		data, err := ioutil.ReadAll(rc)
+		if cerr := rc.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return nil, err
+		}
+		return machoUUIDs(bytes.NewReader(data))
+	}
+	return nil, fmt.Errorf("no app executable found in %s", ipaPath)
+}
+
+// verifyDsymUUIDs checks that every architecture of the app executable has a
+// matching dSYM, so a stale or cached dSYM isn't uploaded by mistake.
+func verifyDsymUUIDs(archivePath string, dsymPaths []string) error {
+	if archivePath == "" {
+		return errors.New("archive_path is required to verify dSYM UUIDs")
+	}
+	appUUIDs, err := appExecutableUUIDs(archivePath)
+	if err != nil {
+		return err
+	}
+	dsyms := map[string]bool{}
+	for _, path := range dsymPaths {
+		found, err := dsymUUIDs(path)
+		if err != nil {
+			return err
+		}
+		for uuid := range found {
+			dsyms[uuid] = true
+		}
+	}
+
+	missing := []string{}
+	for _, uuid := range appUUIDs {
+		if !dsyms[uuid] {
+			missing = append(missing, uuid)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("dSYM UUID mismatch: no dSYM in %s for app UUID(s) %s", strings.Join(dsymPaths, ", "), strings.Join(missing, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+/// Builds a minimal 64-bit Mach-O containing only an LC_UUID load command
+func testMachO(uuid []byte) []byte {
+	buf := make([]byte, 32+24)
+	le := binary.LittleEndian
+	le.PutUint32(buf[0:], 0xfeedfacf) // MH_MAGIC_64
+	le.PutUint32(buf[4:], 0x01000007) // CPU_TYPE_X86_64
+	le.PutUint32(buf[8:], 3)
+	le.PutUint32(buf[12:], 2) // MH_EXECUTE
+	le.PutUint32(buf[16:], 1)
+	le.PutUint32(buf[20:], 24)
+	le.PutUint32(buf[32:], lcUUID)
+	le.PutUint32(buf[36:], 24)
+	copy(buf[40:], uuid)
+	return buf
+}
+
+var appUUID = []byte{0xde, 0xad, 0xbe, 0xef, 0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}
+var staleUUID = []byte{0xca, 0xfe, 0xba, 0xbe, 0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}
+
+func writeTestFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMachoUUIDs(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "App")
+	writeTestFile(t, path, testMachO(appUUID))
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	uuids, err := machoUUIDs(f)
+	if err != nil {
+		t.Fatalf("Test failed: %v", err)
+	}
+	expected := "DEADBEEF-0001-0203-0405-060708090A0B"
+	if len(uuids) != 1 || uuids[0] != expected {
+		t.Errorf("Test failed: expected [%s] but got %v", expected, uuids)
+	}
+}
+
+func TestVerifyDsymUUIDs(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "App.xcarchive")
+	writeTestFile(t, filepath.Join(archive, "Products", "Applications", "App.app", "App"), testMachO(appUUID))
+
+	matching := filepath.Join(dir, "matching", "App.app.dSYM")
+	writeTestFile(t, filepath.Join(matching, "Contents", "Resources", "DWARF", "App"), testMachO(appUUID))
+	stale := filepath.Join(dir, "stale", "App.app.dSYM")
+	writeTestFile(t, filepath.Join(stale, "Contents", "Resources", "DWARF", "App"), testMachO(staleUUID))
+
+	ipa := filepath.Join(dir, "App.ipa")
+	f, err := os.Create(ipa)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := zip.NewWriter(f)
+	entry, err := w.Create("Payload/App.app/App")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := entry.Write(testMachO(appUUID)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		archive string
+		dsyms   []string
+		err     string
+	}{
+		{archive: archive, dsyms: []string{matching}},
+		{archive: ipa, dsyms: []string{stale, filepath.Join(dir, "matching")}},
+		{archive: archive, dsyms: []string{stale}, err: "dSYM UUID mismatch"},
+		{archive: "", dsyms: []string{matching}, err: "archive_path is required"},
+	}
+
+	for _, test := range tests {
+		err := verifyDsymUUIDs(test.archive, test.dsyms)
+		if test.err == "" && err != nil {
+			t.Errorf("Test failed: %v", err)
+		}
+		if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("Test failed: expected error %q but got %v", test.err, err)
+		}
+	}
+}
@@ -4,5 +4,5 @@ go 1.15
 
 require (
 	github.com/bitrise-io/go-steputils v0.0.0-20201016102104-03ae3a6ded35
-	github.com/bitrise-io/go-utils v0.0.0-20201211082830-859032e9adf0 // indirect
+	github.com/bitrise-io/go-utils v0.0.0-20201211082830-859032e9adf0
 )
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/bitrise-io/go-utils/colorstring"
+)
+
+// Logger prints Bitrise-style step output: coloured info, done, warning and
+// error lines, sections with their duration, and debug lines that only appear
+// when debug mode is enabled
+type Logger struct {
+	mu    sync.Mutex
+	out   io.Writer
+	debug bool
+	now   func() time.Time
+}
+
+/// Logger used by the step, writing to stdout
+var logger = newLogger(os.Stdout)
+
+/// Creates a Logger writing to out with debug lines disabled
+func newLogger(out io.Writer) *Logger {
+	return &Logger{out: out, now: time.Now}
+}
+
+// SetDebug enables or disables debug lines
+func (l *Logger) SetDebug(debug bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.debug = debug
+}
+
+func (l *Logger) println(line string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fmt.Fprintln(l.out, line)
+}
+
+// Infof prints a highlighted informational line
+func (l *Logger) Infof(format string, args ...interface{}) {
+	l.println(colorstring.Bluef(format, args...))
+}
+
+// Printf prints a plain line
+func (l *Logger) Printf(format string, args ...interface{}) {
+	l.println(fmt.Sprintf(format, args...))
+}
+
+// Donef prints a line reporting success
+func (l *Logger) Donef(format string, args ...interface{}) {
+	l.println(colorstring.Greenf(format, args...))
+}
+
+// Warnf prints a warning line
+func (l *Logger) Warnf(format string, args ...interface{}) {
+	l.println(colorstring.Yellowf("Warning: "+format, args...))
+}
+
+// Errorf prints an error line
+func (l *Logger) Errorf(format string, args ...interface{}) {
+	l.println(colorstring.Redf("Error: "+format, args...))
+}
+
+// Debugf prints a dimmed line, only when debug mode is enabled
+func (l *Logger) Debugf(format string, args ...interface{}) {
+	l.mu.Lock()
+	debug := l.debug
+	l.mu.Unlock()
+	if debug {
+		l.println(colorstring.Blackf(format, args...))
+	}
+}
+
+// Output prints raw command output as-is
+func (l *Logger) Output(out []byte) {
+	if len(out) == 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fmt.Fprint(l.out, string(out))
+	if out[len(out)-1] != '\n' {
+		fmt.Fprintln(l.out)
+	}
+}
+
+// Section prints a section header and returns a function that closes the
+// section, printing how long it took
+func (l *Logger) Section(format string, args ...interface{}) func() {
+	l.println("")
+	l.Infof(format, args...)
+	start := l.now()
+	return func() {
+		l.Printf("Finished in %s", l.now().Sub(start).Round(time.Millisecond))
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogger(t *testing.T) {
+	t.Parallel()
+	var out bytes.Buffer
+	l := newLogger(&out)
+	start := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+	ticks := []time.Time{start, start.Add(1500 * time.Millisecond)}
+	l.now = func() time.Time {
+		now := ticks[0]
+		ticks = ticks[1:]
+		return now
+	}
+
+	l.Debugf("hidden %d", 1)
+	done := l.Section("Uploading %s", "dsym")
+	l.Output([]byte("sentry-cli output"))
+	l.SetDebug(true)
+	l.Debugf("shown %d", 2)
+	l.Warnf("careful")
+	done()
+
+	logged := out.String()
+	for _, expected := range []string{"Uploading dsym", "sentry-cli output\n", "shown 2", "Warning: careful", "Finished in 1.5s"} {
+		if !strings.Contains(logged, expected) {
+			t.Errorf("Test failed: expected %q in output %q", expected, logged)
+		}
+	}
+	if strings.Contains(logged, "hidden") {
+		t.Errorf("Test failed: debug line printed without debug mode: %q", logged)
+	}
+}
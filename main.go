@@ -2,69 +2,119 @@ package main
 
 import (
 	"errors"
+	"flag"
 	"fmt"
 	"os"
 
 	"github.com/bitrise-io/go-steputils/stepconf"
 )
 
-func delegatePlatformUploads(cfg Config, cmd CommandExecutor) ([]byte, error) {
-	uploads := []SentryCommand{}
-	dsym := SentryCommand{
-		Command:  uploadDifCmd,
-		FilePath: cfg.DsymPath,
-	}
-	proguard := SentryCommand{
-		Command:  uploadProguardCmd,
-		FilePath: cfg.ProguardPath,
-	}
-	if cfg.SelectedPlatform == "ios" {
-		uploads = append(uploads, dsym)
-	} else if cfg.SelectedPlatform == "android" {
-		uploads = append(uploads, proguard)
-	} else if cfg.SelectedPlatform == "both" {
-		uploads = append(uploads, dsym, proguard)
-	} else {
-		return nil, errors.New("Error: selected_platform invalid")
-	}
-
-	for _, upload := range uploads {
-		out, err := uploadSymbols(cfg, upload, cmd)
-		if err != nil {
-			return out, err
-		}
-		fmt.Printf("%s", out)
+// delegatePlatformUploads plans the uploads for the selected platform and
+// runs them. A planning failure is reported as a failed `plan` result.
+func delegatePlatformUploads(cfg Config, cli SentryCli, cmd CommandExecutor) (Report, error) {
+	plan, err := planUploads(cfg, cli)
+	defer plan.Cleanup()
+	if err != nil {
+		result := JobResult{Job: UploadJob{ID: "plan"}, Status: StatusFailed, Reason: err.Error()}
+		return Report{Results: []JobResult{result}}, err
 	}
-	return []byte("Uploads completed"), nil
+	return executePlan(cfg, cli, plan, cmd)
 }
 
-func uploadSymbols(cfg Config, sentry SentryCommand, cmd CommandExecutor) ([]byte, error) {
-	args := buildSentryArgs(cfg, sentry.Command)
-	args = append(args, sentry.FilePath)
-	if cfg.IsDebugMode == "true" {
-		args = append(args, logDebugArg)
+func main() {
+	// the same binary runs as a Bitrise step and as a standalone CLI
+	if err := applyCLIArgs(os.Args[1:], os.Stderr); err == flag.ErrHelp {
+		os.Exit(0)
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(2)
 	}
 
-	fmt.Println(fmt.Sprintf("Executing %s, uploading %s...", sentry.Command, sentry.FilePath))
-	return cmd.execute(sentryCli, args...)
-}
-
-func main() {
 	var cfg Config
 	if err := stepconf.Parse(&cfg); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		logger.Errorf("%s", err)
 		os.Exit(1)
 	}
 	stepconf.Print(cfg)
+	logger.SetDebug(cfg.IsDebugMode)
+	if _, err := cfg.CustomHeaders.Pairs(); err != nil {
+		logger.Errorf("custom_headers: %s", err)
+		os.Exit(1)
+	}
+	if _, err := cfg.SentryCliEnv.Pairs(); err != nil {
+		logger.Errorf("sentry_cli_env: %s", err)
+		os.Exit(1)
+	}
 
 	cmd := StepExecutor{}
 
-	out, err := delegatePlatformUploads(cfg, cmd)
+	if err := resolveAuthToken(&cfg, cmd); err != nil {
+		logger.Errorf("%s", err)
+		os.Exit(1)
+	}
+
+	provenance, err := mergeSentryConfig(&cfg, splitList(cfg.SentryConfigPath))
+	if err != nil {
+		logger.Errorf("%s", err)
+		os.Exit(1)
+	}
+	resolveTokenURL(&cfg, provenance)
+	printProvenance(provenance)
+	if cfg.AuthToken == "" || cfg.OrgSlug == "" {
+		logger.Errorf("auth_token (or auth_token_file / auth_token_command) and org_slug must be set as step inputs or in a Sentry config file")
+		os.Exit(1)
+	}
+
+	resolveRelease(&cfg)
+
+	transport, err := httpTransport(cfg)
+	if err != nil {
+		logger.Errorf("%s", err)
+		os.Exit(1)
+	}
+	if cfg.SkipTLSVerify {
+		logger.Warnf("TLS certificate verification is DISABLED by insecure_skip_tls_verify.")
+		logger.Warnf("Uploads and the auth token can be intercepted. Use ca_bundle_path to trust an internal CA instead.")
+	}
+
+	if !cfg.SkipTokenCheck {
+		done := logger.Section("Checking the auth token")
+		if err := checkAuthToken(cfg, transport); err != nil {
+			logger.Errorf("%s", err)
+			os.Exit(1)
+		}
+		done()
+	}
+
+	done := logger.Section("Resolving sentry-cli")
+	cli, err := resolveSentryCli(cfg, cmd, transport)
+	if err != nil {
+		logger.Errorf("%s", err)
+		os.Exit(1)
+	}
+	logger.Donef("Using sentry-cli %s at %s", cli.Version, cli.Path)
+	done()
+
+	report, err := delegatePlatformUploads(cfg, cli, cmd)
+	if err == nil && cfg.VerificationDSN != "" {
+		result := verifyDelivery(cfg, transport)
+		report.Results = append(report.Results, result)
+		if result.Status == StatusFailed {
+			err = errors.New(result.Reason)
+		}
+	}
+	if failed, ok := report.Failed(); ok {
+		logger.Output(failed.Output)
+	}
+	printReport(report)
+	if exportErr := exportOutputs(report, cmd); exportErr != nil {
+		logger.Warnf("%s", exportErr)
+	}
 	if err != nil {
-		fmt.Printf("%s\n", err)
-		fmt.Printf("%s", string(out))
+		logger.Errorf("%s", err)
 		os.Exit(1)
 	}
 
+	logger.Donef("Uploads completed")
 	os.Exit(0)
 }
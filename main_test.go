@@ -4,11 +4,14 @@ import (
 	"errors"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
+
+	"github.com/bitrise-io/go-steputils/stepconf"
 )
 
 var testConfig = Config{
-	IsDebugMode:  "true",
+	IsDebugMode:  true,
 	AuthToken:    "abcd12345",
 	SentryURL:    "https://sentry.io/",
 	OrgSlug:      "my-org",
@@ -17,28 +20,21 @@ var testConfig = Config{
 	ProguardPath: "path/to/proguard",
 }
 
-/// TestCommandExecutor to mock command execution in tests
-type TestCommandExecutor struct {
-	ret []byte
-	err error
-}
-
-func (c TestCommandExecutor) execute(command string, args ...string) ([]byte, error) {
-	os.Args = args
-	return c.ret, c.err
+var testCli = SentryCli{
+	Path:    sentryCli,
+	Version: Version{2, 21, 2},
 }
 
 func TestDelegatePlatformUploads_Success(t *testing.T) {
+	t.Parallel()
 	var tests = []struct {
-		cmd      CommandExecutor
+		cmd      *RecordingExecutor
 		cfg      Config
-		expected []byte
+		expected string
+		calls    int
 	}{
 		{
-			cmd: TestCommandExecutor{
-				ret: []byte("Success\n"),
-				err: nil,
-			},
+			cmd: respondWith("Success\n"),
 			cfg: Config{
 				SelectedPlatform: "both",
 				IsDebugMode:      testConfig.IsDebugMode,
@@ -49,13 +45,11 @@ func TestDelegatePlatformUploads_Success(t *testing.T) {
 				DsymPath:         testConfig.DsymPath,
 				ProguardPath:     testConfig.ProguardPath,
 			},
-			expected: []byte("Uploads completed"),
+			expected: "success",
+			calls:    2,
 		},
 		{
-			cmd: TestCommandExecutor{
-				ret: []byte("Success\n"),
-				err: nil,
-			},
+			cmd: respondWith("Success\n"),
 			cfg: Config{
 				SelectedPlatform: "android",
 				IsDebugMode:      testConfig.IsDebugMode,
@@ -65,13 +59,11 @@ func TestDelegatePlatformUploads_Success(t *testing.T) {
 				ProjectSlug:      testConfig.ProguardPath,
 				ProguardPath:     testConfig.ProguardPath,
 			},
-			expected: []byte("Uploads completed"),
+			expected: "success",
+			calls:    1,
 		},
 		{
-			cmd: TestCommandExecutor{
-				ret: []byte("Success\n"),
-				err: nil,
-			},
+			cmd: respondWith("Success\n"),
 			cfg: Config{
 				SelectedPlatform: "ios",
 				IsDebugMode:      testConfig.IsDebugMode,
@@ -81,84 +73,156 @@ func TestDelegatePlatformUploads_Success(t *testing.T) {
 				ProjectSlug:      testConfig.ProguardPath,
 				DsymPath:         "mysd",
 			},
-			expected: []byte("Uploads completed"),
+			expected: "success",
+			calls:    1,
 		},
 	}
 
 	for _, test := range tests {
-		out, err := delegatePlatformUploads(test.cfg, test.cmd)
+		report, err := delegatePlatformUploads(test.cfg, testCli, test.cmd)
 		if err != nil {
 			t.Errorf("Test failed: %v", err)
 		}
-		if string(out) != string(test.expected) {
-			t.Errorf("Test failed: expected %v but got %v", test.expected, out)
+		if report.Status() != test.expected {
+			t.Errorf("Test failed: expected %v but got %v", test.expected, report.Summary())
+		}
+		if calls := test.cmd.Calls(); len(calls) != test.calls || len(report.Results) != test.calls {
+			t.Errorf("Test failed: expected %d sentry-cli calls but got %d", test.calls, len(calls))
 		}
-		// reset Args
-		os.Args = []string{}
 	}
 }
 
 func TestDelegatePlatformUploads_Fail(t *testing.T) {
+	t.Parallel()
 	var tests = []struct {
-		cmd      CommandExecutor
+		cmd      *RecordingExecutor
 		cfg      Config
 		expected []byte
 	}{
 		{
-			cmd: TestCommandExecutor{
-				ret: []byte("Error\n"),
-				err: errors.New("An error occurred"),
-			},
+			cmd: failWith("Error\n", errors.New("An error occurred")),
 			cfg: Config{
 				SelectedPlatform: "linux",
 			},
 			expected: []byte{},
 		},
 		{
-			cmd: TestCommandExecutor{
-				ret: []byte("Error\n"),
-				err: errors.New("An error occurred"),
-			},
+			cmd: failWith("Error\n", errors.New("An error occurred")),
 			cfg: Config{
 				SelectedPlatform: "both",
+				ProjectSlug:      testConfig.ProjectSlug,
 			},
 			expected: []byte("Error\n"),
 		},
+		{
+			cmd: respondWith("Success\n"),
+			cfg: Config{
+				SelectedPlatform: "android",
+			},
+			expected: []byte{},
+		},
+		{
+			cmd: respondWith("Success\n"),
+			cfg: Config{
+				SelectedPlatform:  "ios",
+				ProjectSlug:       testConfig.ProjectSlug,
+				DsymPath:          "path/to/missing.dSYM",
+				DsymMissingPolicy: missingFail,
+			},
+			expected: []byte{},
+		},
 	}
 	for _, test := range tests {
-		out, err := delegatePlatformUploads(test.cfg, test.cmd)
+		report, err := delegatePlatformUploads(test.cfg, testCli, test.cmd)
 		if err == nil {
-			t.Errorf("%v: %v", err, string(out))
+			t.Errorf("%v: %v", err, report.Summary())
+		}
+		if report.Status() != "failed" {
+			t.Errorf("Test failed: expected a failed status but got %s: %q", report.Status(), report.Summary())
+		}
+		failed, _ := report.Failed()
+		if string(failed.Output) != string(test.expected) {
+			t.Errorf("Test failed: expected %v but got %v", test.expected, string(failed.Output))
+		}
+	}
+}
+
+func TestConfigParse(t *testing.T) {
+	var tests = []struct {
+		env      map[string]string
+		expected Config
+		err      string
+	}{
+		{
+			env: map[string]string{"platform": "ios", "is_debug_mode": "true", "dsym_uuid_check": "warn", "dsym_missing_policy": "skip", "mapping_missing_policy": "warn", "insecure_skip_tls_verify": "false", "skip_token_check": "false"},
+			expected: Config{
+				SelectedPlatform:     PlatformIOS,
+				IsDebugMode:          true,
+				DsymUUIDCheck:        uuidCheckWarn,
+				DsymMissingPolicy:    missingSkip,
+				MappingMissingPolicy: missingWarn,
+			},
+		},
+		{
+			env: map[string]string{"platform": "linux", "is_debug_mode": "false", "dsym_uuid_check": "off", "dsym_missing_policy": "fail", "mapping_missing_policy": "fail", "insecure_skip_tls_verify": "false", "skip_token_check": "false"},
+			err: "opt[both,ios,android]",
+		},
+		{
+			env: map[string]string{"platform": "both", "is_debug_mode": "yes", "dsym_uuid_check": "off", "dsym_missing_policy": "fail", "mapping_missing_policy": "fail", "insecure_skip_tls_verify": "false", "skip_token_check": "false"},
+			err: "opt[true,false]",
+		},
+		{
+			env: map[string]string{"platform": "both", "is_debug_mode": "false", "dsym_uuid_check": "off", "dsym_missing_policy": "ignore", "mapping_missing_policy": "fail", "insecure_skip_tls_verify": "false", "skip_token_check": "false"},
+			err: "opt[fail,warn,skip]",
+		},
+	}
+
+	for _, test := range tests {
+		for key, value := range test.env {
+			os.Setenv(key, value)
+		}
+		var cfg Config
+		err := stepconf.Parse(&cfg)
+		for key := range test.env {
+			os.Unsetenv(key)
+		}
+
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("Test failed: expected error listing %s but got %v", test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test failed: %v", err)
 		}
-		if string(out) != string(test.expected) {
-			t.Errorf("Test failed: expected %v but got %v", test.expected, string(out))
+		if !reflect.DeepEqual(cfg, test.expected) {
+			t.Errorf("Test failed: expected %+v but got %+v", test.expected, cfg)
 		}
-		// reset Args
-		os.Args = []string{}
 	}
 }
 
-func TestUploadSymbols_Success(t *testing.T) {
+func TestRunJob_Success(t *testing.T) {
+	t.Parallel()
 	var tests = []struct {
-		cmd      CommandExecutor
-		sentry   SentryCommand
+		cmd      *RecordingExecutor
+		job      UploadJob
 		cfg      Config
 		expected []string
 	}{
 		// proguard upload
 		{
-			cmd: TestCommandExecutor{
-				ret: []byte("Success\n"),
-				err: nil,
-			},
-			sentry: SentryCommand{
-				Command:  uploadProguardCmd,
-				FilePath: testConfig.ProguardPath,
+			cmd: respondWith("Success\n"),
+			job: UploadJob{
+				Command: uploadProguardCmd,
+				Files:   []string{testConfig.ProguardPath},
 			},
 			cfg: testConfig,
 			expected: []string{
+				"--url",
+				testConfig.SentryURL,
 				"--auth-token",
-				testConfig.AuthToken,
+				string(testConfig.AuthToken),
 				uploadProguardCmd,
 				"--org",
 				testConfig.OrgSlug,
@@ -170,19 +234,19 @@ func TestUploadSymbols_Success(t *testing.T) {
 		},
 		// dSYM upload
 		{
-			cmd: TestCommandExecutor{
-				ret: []byte("Success\n"),
-				err: nil,
-			},
-			sentry: SentryCommand{
-				Command:  uploadDifCmd,
-				FilePath: testConfig.DsymPath,
+			cmd: respondWith("Success\n"),
+			job: UploadJob{
+				Command: uploadDifCmd,
+				Files:   []string{testConfig.DsymPath},
 			},
 			cfg: testConfig,
 			expected: []string{
+				"--url",
+				testConfig.SentryURL,
 				"--auth-token",
-				testConfig.AuthToken,
-				uploadDifCmd,
+				string(testConfig.AuthToken),
+				"debug-files",
+				"upload",
 				"--org",
 				testConfig.OrgSlug,
 				"--project",
@@ -194,35 +258,89 @@ func TestUploadSymbols_Success(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		_, err := uploadSymbols(test.cfg, test.sentry, test.cmd)
-		if !reflect.DeepEqual(os.Args, test.expected) {
-			t.Errorf("Test failed: Expected args %v, got %v", test.expected, os.Args)
+		_, err := runJob(test.cfg, testCli, test.job, test.cmd)
+		calls := test.cmd.Calls()
+		if len(calls) != 1 || calls[0].Command != testCli.Path {
+			t.Fatalf("Test failed: Expected a single %s call, got %+v", testCli.Path, calls)
+		}
+		if !reflect.DeepEqual(calls[0].Args, test.expected) {
+			t.Errorf("Test failed: Expected args %v, got %v", test.expected, calls[0].Args)
 		}
 		if err != nil {
 			t.Errorf("Test failed with error %v", err)
 		}
-		// reset Args
-		os.Args = []string{}
 	}
 }
 
-func TestUploadSymbols_Failed(t *testing.T) {
-	// var cli =
+func TestPlatformProjects(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		cfg     Config
+		ios     []string
+		android []string
+	}{
+		{
+			cfg:     Config{ProjectSlug: "shared"},
+			ios:     []string{"shared"},
+			android: []string{"shared"},
+		},
+		{
+			cfg:     Config{ProjectSlug: "shared", IosProjectSlug: "ios-app", AndroidProjectSlug: "android-app|android-tv"},
+			ios:     []string{"ios-app"},
+			android: []string{"android-app", "android-tv"},
+		},
+		{
+			cfg:     Config{ProjectSlug: "a, b\nc", IosProjectSlug: " "},
+			ios:     []string{"a", "b", "c"},
+			android: []string{"a", "b", "c"},
+		},
+	}
+
+	for _, test := range tests {
+		if ios := test.cfg.iOSProjects(); !reflect.DeepEqual(ios, test.ios) {
+			t.Errorf("Test failed: expected iOS projects %v but got %v", test.ios, ios)
+		}
+		if android := test.cfg.androidProjects(); !reflect.DeepEqual(android, test.android) {
+			t.Errorf("Test failed: expected Android projects %v but got %v", test.android, android)
+		}
+	}
+}
+
+func TestBuildSentryArgs_MultipleProjects(t *testing.T) {
+	t.Parallel()
+	args := buildSentryArgs(testConfig, testCli, uploadProguardCmd, []string{"app", "tv"})
+	expected := []string{
+		"--url",
+		testConfig.SentryURL,
+		"--auth-token",
+		string(testConfig.AuthToken),
+		uploadProguardCmd,
+		"--org",
+		testConfig.OrgSlug,
+		"--project",
+		"app",
+		"--project",
+		"tv",
+	}
+	if !reflect.DeepEqual(args, expected) {
+		t.Errorf("Test failed: expected args %v, got %v", expected, args)
+	}
+}
+
+func TestRunJob_Failed(t *testing.T) {
+	t.Parallel()
 	var tests = []struct {
-		cmd      CommandExecutor
-		sentry   SentryCommand
+		cmd      *RecordingExecutor
+		job      UploadJob
 		cfg      Config
 		expected error
 	}{
 		// proguard upload
 		{
-			cmd: TestCommandExecutor{
-				ret: nil,
-				err: errors.New("Upload failed"),
-			},
-			sentry: SentryCommand{
-				Command:  uploadProguardCmd,
-				FilePath: testConfig.ProguardPath,
+			cmd: failWith("", errors.New("Upload failed")),
+			job: UploadJob{
+				Command: uploadProguardCmd,
+				Files:   []string{testConfig.ProguardPath},
 			},
 			cfg:      testConfig,
 			expected: errors.New("Upload failed"),
@@ -230,11 +348,9 @@ func TestUploadSymbols_Failed(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		_, err := uploadSymbols(test.cfg, test.sentry, test.cmd)
-		if err == nil {
-			t.Errorf("Test failed: Expected args %v, got %v", test.expected, os.Args)
+		_, err := runJob(test.cfg, testCli, test.job, test.cmd)
+		if err == nil || err.Error() != test.expected.Error() {
+			t.Errorf("Test failed: Expected error %v, got %v", test.expected, err)
 		}
-		// reset Args
-		os.Args = []string{}
 	}
 }
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// MaskedURL is a URL input whose password is masked when printed, so
+// stepconf.Print doesn't show the credentials of e.g. a proxy
+type MaskedURL string
+
+// String masks the password of the URL
+func (u MaskedURL) String() string {
+	parsed, err := url.Parse(string(u))
+	if err != nil {
+		if strings.Contains(string(u), "@") {
+			return "*****"
+		}
+		return string(u)
+	}
+	return parsed.Redacted()
+}
+
+// httpTransport builds the transport of the step's own HTTP requests,
+// downloading sentry-cli and sending the test event, from the `proxy_url`,
+// `no_proxy_hosts`, `ca_bundle_path` and `insecure_skip_tls_verify` inputs.
+// Without a `proxy_url`, the proxy environment variables apply as they do to
+// sentry-cli.
+func httpTransport(cfg Config) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if cfg.ProxyURL != "" {
+		proxy, err := url.Parse(string(cfg.ProxyURL))
+		if err != nil || proxy.Host == "" {
+			return nil, fmt.Errorf("invalid proxy_url %s", cfg.ProxyURL)
+		}
+		noProxy := splitList(cfg.NoProxyHosts)
+		transport.Proxy = func(req *http.Request) (*url.URL, error) {
+			if bypassProxy(req.URL.Hostname(), noProxy) {
+				return nil, nil
+			}
+			return proxy, nil
+		}
+	}
+
+	tlsConfig := &tls.Config{}
+	if cfg.CABundlePath != "" {
+		pem, err := ioutil.ReadFile(cfg.CABundlePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ca_bundle_path: %v", err)
+		}
+		// the bundle replaces the system CAs, as it does for sentry-cli
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no PEM certificates found in %s", cfg.CABundlePath)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	tlsConfig.InsecureSkipVerify = cfg.SkipTLSVerify
+	transport.TLSClientConfig = tlsConfig
+	return transport, nil
+}
+
+// bypassProxy reports whether host matches the no-proxy list, which holds
+// hosts, IPs, domains matching their subdomains (with or without a leading
+// dot) or `*` for every host, the way curl reads `no_proxy`
+func bypassProxy(host string, noProxy []string) bool {
+	host = strings.ToLower(host)
+	for _, entry := range noProxy {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if h, _, err := net.SplitHostPort(entry); err == nil {
+			entry = h
+		}
+		if entry == "*" || entry == host {
+			return true
+		}
+		domain := strings.TrimPrefix(entry, ".")
+		if domain != "" && (domain == host || strings.HasSuffix(host, "."+domain)) {
+			return true
+		}
+	}
+	return false
+}
+
+// networkEnv returns the environment passing the same network settings to
+// sentry-cli, which reads the proxy through curl's variables, the CA bundle
+// through OpenSSL's and the TLS verification toggle through its own
+func networkEnv(cfg Config) []string {
+	env := []string{}
+	if cfg.ProxyURL != "" {
+		for _, key := range []string{"http_proxy", "https_proxy", "HTTP_PROXY", "HTTPS_PROXY"} {
+			env = append(env, key+"="+string(cfg.ProxyURL))
+		}
+	}
+	if noProxy := strings.Join(splitList(cfg.NoProxyHosts), ","); noProxy != "" {
+		env = append(env, "no_proxy="+noProxy, "NO_PROXY="+noProxy)
+	}
+	if cfg.CABundlePath != "" {
+		env = append(env, "SSL_CERT_FILE="+cfg.CABundlePath, "CURL_CA_BUNDLE="+cfg.CABundlePath)
+	}
+	if cfg.SkipTLSVerify {
+		env = append(env, "SENTRY_HTTP_VERIFY_SSL=false")
+	}
+	return env
+}
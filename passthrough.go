@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+/// Parts of a key marking its value as secret, matched case-insensitively
+var sensitiveKeyParts = []string{"TOKEN", "SECRET", "PASSWORD", "PASSWD", "AUTH", "KEY", "COOKIE", "CREDENTIAL", "DSN"}
+
+// EnvList is an input of `KEY=VALUE` lines passed to sentry-cli's
+// environment, e.g. `SENTRY_LOG_LEVEL=info`
+type EnvList string
+
+// HeaderList is an input of `Name: value` lines sent as extra HTTP headers
+// with every sentry-cli request
+type HeaderList string
+
+// String masks the values of sensitive-looking keys, so stepconf.Print
+// doesn't show them
+func (l EnvList) String() string {
+	return maskLines(string(l), "=")
+}
+
+// String masks the values of sensitive-looking headers, so stepconf.Print
+// doesn't show them
+func (l HeaderList) String() string {
+	return maskLines(string(l), ":")
+}
+
+// Pairs returns the `KEY=VALUE` lines, failing on lines without a key
+func (l EnvList) Pairs() ([]string, error) {
+	return splitLines(string(l), "=", "KEY=VALUE")
+}
+
+// Pairs returns the `Name: value` lines, failing on lines without a name
+func (l HeaderList) Pairs() ([]string, error) {
+	return splitLines(string(l), ":", "Name: value")
+}
+
+/// Returns the non-blank, non-comment lines of s, each checked for a key
+func splitLines(s, sep, format string) ([]string, error) {
+	lines := []string{}
+	for n, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if i := strings.Index(line, sep); i <= 0 || strings.TrimSpace(line[:i]) == "" {
+			return nil, fmt.Errorf("line %d: expected %s", n+1, format)
+		}
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
+
+/// Reports whether the value of key looks like it should be kept secret
+func isSensitiveKey(key string) bool {
+	key = strings.ToUpper(key)
+	for _, part := range sensitiveKeyParts {
+		if strings.Contains(key, part) {
+			return true
+		}
+	}
+	return false
+}
+
+/// Replaces the value of each sensitive line of s with asterisks
+func maskLines(s, sep string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if key, masked := maskLine(line, sep); masked {
+			lines[i] = key + sep + "*****"
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+/// Returns the key of a sensitive line and true, or the line and false
+func maskLine(line, sep string) (string, bool) {
+	i := strings.Index(line, sep)
+	if i <= 0 || !isSensitiveKey(line[:i]) {
+		return line, false
+	}
+	return line[:i], true
+}
+
+// sentryCliEnv is the environment sentry-cli runs with on top of the step's:
+// the network settings followed by the `sentry_cli_env` lines, so the latter
+// can override the former
+func sentryCliEnv(cfg Config) []string {
+	env := networkEnv(cfg)
+	pairs, _ := cfg.SentryCliEnv.Pairs()
+	for _, pair := range pairs {
+		i := strings.Index(pair, "=")
+		env = append(env, strings.TrimSpace(pair[:i])+"="+strings.TrimSpace(pair[i+1:]))
+	}
+	return env
+}
+
+// setCustomHeaders sets the `custom_headers` on a request the step sends to
+// Sentry itself, so it gets through the same gateway as sentry-cli
+func setCustomHeaders(req *http.Request, headers HeaderList) {
+	pairs, _ := headers.Pairs()
+	for _, pair := range pairs {
+		i := strings.Index(pair, ":")
+		req.Header.Set(strings.TrimSpace(pair[:i]), strings.TrimSpace(pair[i+1:]))
+	}
+}
+
+// sentryCliSecrets lists the values to mask when logging a sentry-cli command:
+// the auth token and the sensitive `--header` arguments
+func sentryCliSecrets(cfg Config) []string {
+	secrets := []string{string(cfg.AuthToken)}
+	headers, _ := cfg.CustomHeaders.Pairs()
+	for _, header := range headers {
+		if _, masked := maskLine(header, ":"); masked {
+			secrets = append(secrets, header)
+		}
+	}
+	return secrets
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEnvList(t *testing.T) {
+	t.Parallel()
+	env := EnvList("SENTRY_LOG_LEVEL=info\n# retries for the flaky gateway\nSENTRY_HTTP_MAX_RETRIES = 5\nGATEWAY_TOKEN=hunter2\n")
+
+	if printed := fmt.Sprintf("%v", env); strings.Contains(printed, "hunter2") || !strings.Contains(printed, "GATEWAY_TOKEN=*****") || !strings.Contains(printed, "SENTRY_LOG_LEVEL=info") {
+		t.Errorf("Test failed: expected only the token to be masked but got %q", printed)
+	}
+	headers := HeaderList("X-Gateway: mobile\nAuthorization: Bearer hunter2")
+	if printed := fmt.Sprintf("%v", headers); printed != "X-Gateway: mobile\nAuthorization:*****" {
+		t.Errorf("Test failed: expected the authorization header to be masked but got %q", printed)
+	}
+
+	cfg := testConfig
+	cfg.SentryCliEnv = env
+	cfg.CustomHeaders = headers
+	cmd := respondWith("Success\n")
+	if _, err := runJob(cfg, testCli, UploadJob{ID: "dsym", Command: uploadDifCmd, Files: []string{"App.dSYM"}}, cmd); err != nil {
+		t.Fatalf("Test failed: %v", err)
+	}
+	calls := cmd.Calls()
+	expectedEnv := []string{"SENTRY_LOG_LEVEL=info", "SENTRY_HTTP_MAX_RETRIES=5", "GATEWAY_TOKEN=hunter2"}
+	if !reflect.DeepEqual(calls[0].Env, expectedEnv) {
+		t.Errorf("Test failed: expected env %v but got %v", expectedEnv, calls[0].Env)
+	}
+	args := strings.Join(calls[0].Args, " ")
+	if !strings.Contains(args, "--header X-Gateway: mobile --header Authorization: Bearer hunter2 debug-files upload") {
+		t.Errorf("Test failed: expected the headers as global options but got %q", args)
+	}
+	redacted := redactArgs(calls[0].Args, sentryCliSecrets(cfg)...)
+	if strings.Contains(strings.Join(redacted, " "), "hunter2") {
+		t.Errorf("Test failed: expected the authorization header to be redacted but got %v", redacted)
+	}
+
+	if _, err := EnvList("SENTRY_LOG_LEVEL=info\nnot a pair").Pairs(); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("Test failed: expected a malformed line error but got %v", err)
+	}
+	if _, err := HeaderList(": no name").Pairs(); err == nil {
+		t.Errorf("Test failed: expected a header without a name to be rejected")
+	}
+}
@@ -0,0 +1,437 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// UploadJob is a single sentry-cli invocation
+type UploadJob struct {
+	ID      string
+	Command string
+	// Args are passed after the command's options, ahead of the files
+	Args     []string
+	Files    []string
+	Projects []string
+	// DependsOn lists the IDs of the jobs that have to succeed first
+	DependsOn []string
+	// Variant is the Android build variant of a mapping upload
+	Variant string
+	// App is the version of the app the symbols belong to
+	App AppVersion
+	// Checksum is the SHA-256 of a mapping file
+	Checksum string
+	// DuplicateOf is the ID of the job uploading the same mapping
+	DuplicateOf string
+	// Status and Reason are set when planning decided the job won't run,
+	// e.g. because its artefact is missing
+	Status string
+	Reason string
+}
+
+// Missing artefact policies for the `*_missing_policy` inputs
+const (
+	missingFail = "fail"
+	missingWarn = "warn"
+	missingSkip = "skip"
+)
+
+// MissingArtefactError reports a configured or discovered artefact that
+// doesn't exist
+type MissingArtefactError struct {
+	Artefact string
+	Path     string
+}
+
+// Error describes the missing artefact and where it was expected
+func (e *MissingArtefactError) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("no %s path set", e.Artefact)
+	}
+	return fmt.Sprintf("%s not found at %s", e.Artefact, e.Path)
+}
+
+// UploadPlan is the ordered list of jobs a run executes, along with any
+// scratch directories to remove once it's done
+type UploadPlan struct {
+	Jobs    []UploadJob
+	cleanup []func()
+}
+
+// Cleanup removes the temporary files created while planning
+func (p UploadPlan) Cleanup() {
+	for _, cleanup := range p.cleanup {
+		cleanup()
+	}
+}
+
+// planUploads decides what the run will upload for the selected platform with
+// cli. It resolves and verifies the dSYMs but doesn't run sentry-cli.
+func planUploads(cfg Config, cli SentryCli) (UploadPlan, error) {
+	plan := UploadPlan{}
+
+	var uploadDsym, uploadProguard bool
+	switch cfg.SelectedPlatform {
+	case PlatformIOS:
+		uploadDsym = true
+	case PlatformAndroid:
+		uploadProguard = true
+	case PlatformBoth:
+		uploadDsym, uploadProguard = true, true
+	default:
+		return plan, fmt.Errorf("platform %q invalid, expected one of %s, %s or %s", cfg.SelectedPlatform, PlatformBoth, PlatformIOS, PlatformAndroid)
+	}
+
+	if uploadDsym && len(cfg.iOSProjects()) == 0 {
+		return plan, errors.New("no project_slug or ios_project_slug set")
+	}
+	if uploadProguard && len(cfg.androidProjects()) == 0 {
+		return plan, errors.New("no project_slug or android_project_slug set")
+	}
+
+	if uploadDsym {
+		job := UploadJob{
+			ID:       "dsym",
+			Command:  uploadDifCmd,
+			Projects: cfg.iOSProjects(),
+		}
+		if cfg.ArchivePath != "" {
+			if version, err := iosAppVersion(cfg.ArchivePath); err == nil {
+				job.App = version
+			} else {
+				logger.Debugf("No app version for the dSYMs: %s", err)
+			}
+		}
+		dsyms, err := resolveDsyms(cfg)
+		plan.cleanup = append(plan.cleanup, dsyms.Cleanup)
+		if err == nil && cfg.DsymMissingPolicy != "" {
+			err = checkArtefactsExist("dSYM", dsyms.Paths)
+		}
+		if err == nil {
+			err = checkDsymUUIDs(cfg, dsyms.Paths)
+			job.Files = dsyms.Paths
+		}
+		if job, err = applyMissingPolicy(cfg.DsymMissingPolicy, job, err); err != nil {
+			return plan, err
+		}
+		plan.Jobs = append(plan.Jobs, job)
+	}
+	if uploadProguard {
+		jobs, err := planMappingUploads(cfg)
+		if err != nil {
+			return plan, err
+		}
+		plan.Jobs = append(plan.Jobs, jobs...)
+	}
+
+	artefacts, err := planArtefactUploads(cfg, cli)
+	if err != nil {
+		return plan, err
+	}
+	plan.Jobs = append(plan.Jobs, artefacts...)
+	plan.Jobs = splitByProject(plan.Jobs)
+
+	if cfg.DeployEnvironment != "" {
+		job, err := planDeploy(cfg, plan.Jobs)
+		if err != nil {
+			return plan, err
+		}
+		plan.Jobs = append(plan.Jobs, job)
+	}
+	return plan, nil
+}
+
+// splitByProject replaces each job uploading to several projects with one
+// job per project, as the upload commands only take a single `--project`.
+// The project is appended to the IDs of the jobs it splits.
+func splitByProject(jobs []UploadJob) []UploadJob {
+	split := []UploadJob{}
+	for _, job := range jobs {
+		if len(job.Projects) <= 1 {
+			split = append(split, job)
+			continue
+		}
+		for _, project := range job.Projects {
+			perProject := job
+			perProject.ID = job.ID + "-" + project
+			perProject.Projects = []string{project}
+			if job.DuplicateOf != "" {
+				perProject.DuplicateOf = job.DuplicateOf + "-" + project
+			}
+			split = append(split, perProject)
+		}
+	}
+	return split
+}
+
+// planDeploy plans the `releases deploys <release> new` job recording a
+// deploy of the release to `deploy_environment`. It depends on every upload
+// job, so it only runs once all of the symbols are uploaded.
+func planDeploy(cfg Config, uploads []UploadJob) (UploadJob, error) {
+	if cfg.Release == "" {
+		return UploadJob{}, errors.New("deploy_environment is set but no release is")
+	}
+	job := UploadJob{
+		ID:      "deploy",
+		Command: deployCmd,
+		Args:    []string{cfg.Release, "new", "--env", cfg.DeployEnvironment},
+	}
+	if cfg.DeployName != "" {
+		job.Args = append(job.Args, "--name", cfg.DeployName)
+	}
+	if cfg.DeployURL != "" {
+		job.Args = append(job.Args, "--url", cfg.DeployURL)
+	}
+	for _, upload := range uploads {
+		job.DependsOn = append(job.DependsOn, upload.ID)
+	}
+	return job, nil
+}
+
+// planMappingUploads plans one `upload-proguard` job per mapping file, each
+// tagged with its build variant and, when Gradle's output metadata is found,
+// the version of the build. Mappings are checked for sensible content,
+// and a mapping identical to one already planned is skipped.
+func planMappingUploads(cfg Config) ([]UploadJob, error) {
+	mappings, err := resolveMappings(cfg.ProguardPath, splitList(cfg.AndroidVariants))
+	if err != nil {
+		job := UploadJob{
+			ID:       "proguard",
+			Command:  uploadProguardCmd,
+			Projects: cfg.androidProjects(),
+		}
+		job, err = applyMissingPolicy(cfg.MappingMissingPolicy, job, err)
+		return []UploadJob{job}, err
+	}
+
+	jobs := []UploadJob{}
+	planned := map[string]string{}
+	for _, mapping := range mappings {
+		job := UploadJob{
+			ID:       "proguard",
+			Command:  uploadProguardCmd,
+			Files:    []string{mapping.Path},
+			Projects: cfg.androidProjects(),
+			Variant:  mapping.Label(),
+		}
+		if job.Variant != "" {
+			job.ID += "-" + strings.Replace(job.Variant, ":", "-", -1)
+		}
+		if version, ok := mappingAppVersion(mapping); ok {
+			job.App = version
+			job.Args = []string{"--app-id", version.ID, "--version", version.Version}
+			if version.Build != "" {
+				job.Args = append(job.Args, "--version-code", version.Build)
+			}
+		}
+		var err error
+		if cfg.MappingMissingPolicy != "" {
+			err = checkArtefactsExist("Proguard mapping", job.Files)
+		}
+		if job, err = applyMissingPolicy(cfg.MappingMissingPolicy, job, err); err != nil {
+			return nil, err
+		}
+		if job.Status == "" {
+			if job, err = checkMapping(job, planned); err != nil {
+				return nil, err
+			}
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// checkMapping inspects the mapping of a job, skipping it when its content is
+// identical to a mapping already planned. planned maps checksums to job IDs.
+// Mappings that don't exist are left for sentry-cli to report.
+func checkMapping(job UploadJob, planned map[string]string) (UploadJob, error) {
+	path := job.Files[0]
+	if _, err := os.Stat(path); err != nil {
+		return job, nil
+	}
+	checksum, err := inspectMapping(path)
+	if err != nil {
+		return job, err
+	}
+	job.Checksum = checksum
+	logger.Debugf("%s SHA-256: %s", path, checksum)
+
+	if previous, ok := planned[checksum]; ok {
+		logger.Printf("%s is identical to the mapping of %s, skipping it", path, previous)
+		job.Status = StatusSkipped
+		job.Reason = "identical to " + previous
+		job.DuplicateOf = previous
+		return job, nil
+	}
+	planned[checksum] = job.ID
+	return job, nil
+}
+
+// executePlan runs the jobs of a plan in order, stopping at the first failure.
+// A job only runs once all of its dependencies have been uploaded, or skipped
+// as duplicates of an uploaded mapping. Jobs depending on an artefact left
+// out by its missing artefact policy don't run. The report covers every job
+// of the plan, including those that didn't run.
+func executePlan(cfg Config, cli SentryCli, plan UploadPlan, cmd CommandExecutor) (Report, error) {
+	report := Report{}
+	seen := map[string]bool{}
+	satisfied := map[string]bool{}
+	for i, job := range plan.Jobs {
+		seen[job.ID] = true
+		if job.Status != "" {
+			report.Results = append(report.Results, JobResult{Job: job, Status: job.Status, Reason: job.Reason})
+			satisfied[job.ID] = job.DuplicateOf != "" && satisfied[job.DuplicateOf]
+			continue
+		}
+		unmet := ""
+		for _, dependency := range job.DependsOn {
+			if !seen[dependency] {
+				err := fmt.Errorf("job %s depends on %s, which hasn't run", job.ID, dependency)
+				report.Results = append(report.Results, JobResult{Job: job, Status: StatusFailed, Reason: err.Error()})
+				return report, err
+			}
+			if !satisfied[dependency] && unmet == "" {
+				unmet = dependency
+			}
+		}
+		if unmet != "" {
+			logger.Warnf("%s wasn't uploaded, not running %s", unmet, job.ID)
+			report.Results = append(report.Results, JobResult{Job: job, Status: StatusNotRun, Reason: unmet + " wasn't uploaded"})
+			continue
+		}
+
+		start := time.Now()
+		verb := "Uploading"
+		if len(job.Files) == 0 {
+			verb = "Running"
+		}
+		done := logger.Section("%s %s (%s)", verb, job.ID, job.Command)
+		if job.Variant != "" {
+			logger.Printf("Build variant: %s", job.Variant)
+		}
+		if job.App.ID != "" {
+			logger.Printf("App version: %s", job.App.ReleaseName())
+		}
+		out, err := runJob(cfg, cli, job, cmd)
+		result := JobResult{Job: job, Status: StatusUploaded, Output: out, Duration: time.Since(start)}
+		if err != nil {
+			result.Status = StatusFailed
+			result.Reason = err.Error()
+			report.Results = append(report.Results, result)
+			for _, rest := range plan.Jobs[i+1:] {
+				// statuses decided while planning still hold
+				if rest.Status != "" {
+					report.Results = append(report.Results, JobResult{Job: rest, Status: rest.Status, Reason: rest.Reason})
+					continue
+				}
+				report.Results = append(report.Results, JobResult{Job: rest, Status: StatusNotRun})
+			}
+			return report, err
+		}
+		logger.Output(out)
+		done()
+		report.Results = append(report.Results, result)
+		satisfied[job.ID] = true
+	}
+	return report, nil
+}
+
+// applyMissingPolicy decides what happens to a job whose artefact couldn't be
+// found: `fail` returns the error, `warn` and `skip` keep the job in the plan
+// without running it. Other errors, or no policy at all, are returned as-is.
+func applyMissingPolicy(policy string, job UploadJob, err error) (UploadJob, error) {
+	var missing *MissingArtefactError
+	if err == nil || !errors.As(err, &missing) {
+		return job, err
+	}
+	switch policy {
+	case missingWarn:
+		logger.Warnf("%s, not uploading %s", missing, job.ID)
+		job.Status = StatusMissing
+	case missingSkip:
+		logger.Printf("%s, skipping %s", missing, job.ID)
+		job.Status = StatusSkipped
+	default:
+		return job, err
+	}
+	job.Reason = missing.Error()
+	return job, nil
+}
+
+/// Returns a MissingArtefactError for the first path that doesn't exist
+func checkArtefactsExist(artefact string, paths []string) error {
+	if len(paths) == 0 {
+		return &MissingArtefactError{Artefact: artefact}
+	}
+	for _, path := range paths {
+		if path == "" {
+			return &MissingArtefactError{Artefact: artefact}
+		}
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return &MissingArtefactError{Artefact: artefact, Path: path}
+		}
+	}
+	return nil
+}
+
+// checkDsymUUIDs applies the `dsym_uuid_check` mode, returning an error only
+// when a mismatch should fail the step.
+func checkDsymUUIDs(cfg Config, dsymPaths []string) error {
+	if cfg.DsymUUIDCheck == "" || cfg.DsymUUIDCheck == uuidCheckOff {
+		return nil
+	}
+	err := verifyDsymUUIDs(cfg.ArchivePath, dsymPaths)
+	if err == nil {
+		logger.Donef("dSYM UUIDs match the app executable")
+		return nil
+	}
+	if cfg.DsymUUIDCheck == uuidCheckWarn {
+		logger.Warnf("%s", err)
+		return nil
+	}
+	return err
+}
+
+/// Builds the full sentry-cli argument list for a job
+func jobArgs(cfg Config, cli SentryCli, job UploadJob) []string {
+	args := buildSentryArgs(cfg, cli, job.Command, job.Projects)
+	args = append(args, job.Args...)
+	args = append(args, job.Files...)
+	if cfg.IsDebugMode {
+		args = append(args, logDebugArg)
+	}
+	return args
+}
+
+func runJob(cfg Config, cli SentryCli, job UploadJob, cmd CommandExecutor) ([]byte, error) {
+	if err := checkCommandSupported(job.Command, cli.Version); err != nil {
+		return nil, err
+	}
+	args := jobArgs(cfg, cli, job)
+	if len(job.Files) > 0 {
+		logger.Printf("Executing %s, uploading %s...", job.Command, strings.Join(job.Files, ", "))
+	} else {
+		logger.Printf("Executing %s...", job.Command)
+	}
+	logger.Debugf("$ %s %s", cli.Path, strings.Join(redactArgs(args, sentryCliSecrets(cfg)...), " "))
+	inv := newInvocation(cli.Path, args...)
+	inv.Env = sentryCliEnv(cfg)
+	return cmd.execute(inv)
+}
+
+/// Masks secret values in a list of arguments before it's logged
+func redactArgs(args []string, secrets ...string) []string {
+	redacted := make([]string, len(args))
+	for i, arg := range args {
+		redacted[i] = arg
+		for _, secret := range secrets {
+			if secret != "" && arg == secret {
+				redacted[i] = "*****"
+			}
+		}
+	}
+	return redacted
+}
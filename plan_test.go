@@ -0,0 +1,249 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPlanUploads(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		cfg      Config
+		expected []UploadJob
+	}{
+		{
+			cfg: Config{
+				SelectedPlatform: PlatformBoth,
+				ProjectSlug:      "shared",
+				IosProjectSlug:   "ios-app",
+				DsymPath:         "path/to/dsym",
+				ProguardPath:     "path/to/mapping.txt",
+			},
+			expected: []UploadJob{
+				{ID: "dsym", Command: uploadDifCmd, Files: []string{"path/to/dsym"}, Projects: []string{"ios-app"}},
+				{ID: "proguard", Command: uploadProguardCmd, Files: []string{"path/to/mapping.txt"}, Projects: []string{"shared"}},
+			},
+		},
+		{
+			cfg: Config{
+				SelectedPlatform: PlatformAndroid,
+				ProjectSlug:      "shared",
+				DsymPath:         "path/to/dsym",
+				ProguardPath:     "path/to/mapping.txt",
+			},
+			expected: []UploadJob{
+				{ID: "proguard", Command: uploadProguardCmd, Files: []string{"path/to/mapping.txt"}, Projects: []string{"shared"}},
+			},
+		},
+		{
+			cfg: Config{
+				SelectedPlatform: PlatformBoth,
+				ProjectSlug:      "shared",
+				IosProjectSlug:   "ios-app|ios-widget",
+				DsymPath:         "path/to/dsym",
+				ProguardPath:     "path/to/mapping.txt",
+			},
+			expected: []UploadJob{
+				{ID: "dsym-ios-app", Command: uploadDifCmd, Files: []string{"path/to/dsym"}, Projects: []string{"ios-app"}},
+				{ID: "dsym-ios-widget", Command: uploadDifCmd, Files: []string{"path/to/dsym"}, Projects: []string{"ios-widget"}},
+				{ID: "proguard", Command: uploadProguardCmd, Files: []string{"path/to/mapping.txt"}, Projects: []string{"shared"}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		plan, err := planUploads(test.cfg, testCli)
+		plan.Cleanup()
+		if err != nil {
+			t.Errorf("Test failed: %v", err)
+		}
+		if !reflect.DeepEqual(plan.Jobs, test.expected) {
+			t.Errorf("Test failed: expected %+v but got %+v", test.expected, plan.Jobs)
+		}
+	}
+}
+
+func TestExecutePlan_Dependencies(t *testing.T) {
+	t.Parallel()
+	plan := UploadPlan{Jobs: []UploadJob{
+		{ID: "deploy", Command: uploadProguardCmd, DependsOn: []string{"proguard"}},
+		{ID: "proguard", Command: uploadProguardCmd},
+	}}
+	cmd := respondWith("Success\n")
+
+	report, err := executePlan(testConfig, testCli, plan, cmd)
+	if err == nil || !strings.Contains(err.Error(), "depends on proguard") {
+		t.Errorf("Test failed: expected an unmet dependency error but got %v", err)
+	}
+	if report.Status() != "failed" {
+		t.Errorf("Test failed: expected a failed status but got %s", report.Status())
+	}
+	if calls := cmd.Calls(); len(calls) != 0 {
+		t.Errorf("Test failed: expected no sentry-cli calls but got %+v", calls)
+	}
+}
+
+func TestExecutePlan_DeployDependencies(t *testing.T) {
+	t.Parallel()
+	deploy := UploadJob{ID: "deploy", Command: deployCmd, DependsOn: []string{"proguard-free", "proguard-paid"}}
+	var tests = []struct {
+		paid     UploadJob
+		expected string
+	}{
+		{paid: UploadJob{ID: "proguard-paid", Command: uploadProguardCmd}, expected: StatusUploaded},
+		{paid: UploadJob{ID: "proguard-paid", Command: uploadProguardCmd, Status: StatusSkipped, DuplicateOf: "proguard-free"}, expected: StatusUploaded},
+		{paid: UploadJob{ID: "proguard-paid", Command: uploadProguardCmd, Status: StatusMissing}, expected: StatusNotRun},
+		{paid: UploadJob{ID: "proguard-paid", Command: uploadProguardCmd, Status: StatusSkipped}, expected: StatusNotRun},
+	}
+
+	for _, test := range tests {
+		plan := UploadPlan{Jobs: []UploadJob{{ID: "proguard-free", Command: uploadProguardCmd}, test.paid, deploy}}
+		report, err := executePlan(testConfig, testCli, plan, respondWith("Success\n"))
+		if err != nil {
+			t.Errorf("Test failed: %v", err)
+			continue
+		}
+		if status := report.Results[2].Status; status != test.expected {
+			t.Errorf("Test failed: expected the deploy to be %s after a %q mapping but got %s", test.expected, test.paid.Status, status)
+		}
+	}
+}
+
+func TestExecutePlan_KeepsPlannedStatuses(t *testing.T) {
+	t.Parallel()
+	plan := UploadPlan{Jobs: []UploadJob{
+		{ID: "dsym", Command: uploadDifCmd},
+		{ID: "proguard-free", Command: uploadProguardCmd, Status: StatusMissing, Reason: "Proguard mapping not found at free/mapping.txt"},
+		{ID: "proguard-paid", Command: uploadProguardCmd},
+	}}
+	report, err := executePlan(testConfig, testCli, plan, failWith("Error\n", errors.New("exit status 1")))
+	if err == nil {
+		t.Fatal("Test failed: expected the dSYM upload to fail")
+	}
+	expected := "dsym: failed (exit status 1)\nproguard-free: missing (Proguard mapping not found at free/mapping.txt)\nproguard-paid: not run"
+	if summary := report.Summary(); summary != expected {
+		t.Errorf("Test failed: expected %q but got %q", expected, summary)
+	}
+}
+
+func TestPlanUploads_MissingPolicy(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		policy string
+		status string
+		err    bool
+	}{
+		{policy: missingFail, err: true},
+		{policy: missingWarn, status: StatusMissing},
+		{policy: missingSkip, status: StatusSkipped},
+	}
+
+	for _, test := range tests {
+		cfg := Config{
+			SelectedPlatform:     PlatformAndroid,
+			ProjectSlug:          "shared",
+			ProguardPath:         "does/not/exist/mapping.txt",
+			MappingMissingPolicy: test.policy,
+		}
+		plan, err := planUploads(cfg, testCli)
+		plan.Cleanup()
+		if test.err {
+			if err == nil {
+				t.Errorf("Test failed: expected %s to fail the plan", test.policy)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Test failed: %v", err)
+		}
+		if len(plan.Jobs) != 1 || plan.Jobs[0].Status != test.status {
+			t.Fatalf("Test failed: expected a %s job but got %+v", test.status, plan.Jobs)
+		}
+
+		cmd := respondWith("Success\n")
+		report, err := executePlan(cfg, testCli, plan, cmd)
+		if err != nil || len(cmd.Calls()) != 0 {
+			t.Errorf("Test failed: expected no upload but got %v, %+v", err, cmd.Calls())
+		}
+		expected := "proguard: " + test.status + " (Proguard mapping not found at does/not/exist/mapping.txt)"
+		if report.Status() != "success" || report.Summary() != expected {
+			t.Errorf("Test failed: expected %q but got %s %q", expected, report.Status(), report.Summary())
+		}
+	}
+}
+
+func TestExportOutputs(t *testing.T) {
+	t.Parallel()
+	report := Report{Results: []JobResult{
+		{Job: UploadJob{ID: "dsym"}, Status: StatusUploaded},
+		{Job: UploadJob{ID: "proguard"}, Status: StatusSkipped, Reason: "no Proguard mapping path set"},
+	}}
+	cmd := respondWith("")
+	if err := exportOutputs(report, cmd); err != nil {
+		t.Fatalf("Test failed: %v", err)
+	}
+
+	expected := []Invocation{
+		newInvocation("envman", "add", "--key", outputStatus, "--value", "success"),
+		newInvocation("envman", "add", "--key", outputSummary, "--value", "dsym: uploaded\nproguard: skipped (no Proguard mapping path set)"),
+	}
+	if calls := cmd.Calls(); !reflect.DeepEqual(calls, expected) {
+		t.Errorf("Test failed: expected %+v but got %+v", expected, calls)
+	}
+}
+
+func TestPlanUploads_Deploy(t *testing.T) {
+	t.Parallel()
+	cfg := Config{
+		SelectedPlatform:  PlatformBoth,
+		ProjectSlug:       "shared",
+		DsymPath:          "path/to/dsym",
+		ProguardPath:      "path/to/mapping.txt",
+		Release:           "com.example.app@1.2.0+42",
+		DeployEnvironment: "testflight",
+		DeployURL:         "https://app.bitrise.io/build/1",
+	}
+	plan, err := planUploads(cfg, testCli)
+	plan.Cleanup()
+	if err != nil {
+		t.Fatalf("Test failed: %v", err)
+	}
+	expected := UploadJob{
+		ID:        "deploy",
+		Command:   deployCmd,
+		Args:      []string{"com.example.app@1.2.0+42", "new", "--env", "testflight", "--url", "https://app.bitrise.io/build/1"},
+		DependsOn: []string{"dsym", "proguard"},
+	}
+	if len(plan.Jobs) != 3 || !reflect.DeepEqual(plan.Jobs[2], expected) {
+		t.Fatalf("Test failed: expected %+v last but got %+v", expected, plan.Jobs)
+	}
+
+	cmd := respondWith("Success\n")
+	if _, err := executePlan(testConfig, testCli, plan, cmd); err != nil {
+		t.Fatalf("Test failed: %v", err)
+	}
+	calls := cmd.Calls()
+	deployArgs := append(buildSentryArgs(testConfig, testCli, deployCmd, nil), append(expected.Args, logDebugArg)...)
+	if len(calls) != 3 || !reflect.DeepEqual(calls[2].Args, deployArgs) {
+		t.Errorf("Test failed: expected the deploy last with %v but got %+v", deployArgs, calls)
+	}
+
+	cmd = newRecordingExecutor(ScriptedResponse{ret: []byte("Success\n")}, ScriptedResponse{ret: []byte("Failed\n"), err: errors.New("exit status 1")})
+	report, err := executePlan(testConfig, testCli, plan, cmd)
+	if err == nil {
+		t.Fatal("Test failed: expected the mapping upload to fail")
+	}
+	if calls := cmd.Calls(); len(calls) != 2 {
+		t.Errorf("Test failed: expected no deploy after a failed upload but got %+v", calls)
+	}
+	if status := report.Results[2].Status; status != StatusNotRun {
+		t.Errorf("Test failed: expected the deploy not to run but got %s", status)
+	}
+
+	cfg.Release = ""
+	if _, err := planUploads(cfg, testCli); err == nil {
+		t.Error("Test failed: expected a deploy without a release to fail")
+	}
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+/// Magic bytes starting a binary property list
+var binaryPlistMagic = []byte("bplist00")
+
+/// Reference date of binary plist dates, which count seconds from it
+var plistEpoch = time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)
+
+/// Deepest nesting of arrays and dictionaries accepted in a binary plist
+const maxPlistDepth = 64
+
+// parsePlist decodes an XML or binary property list into Go values:
+// dictionaries become map[string]interface{}, arrays []interface{}, integers
+// int64, reals float64, booleans bool, strings string, dates RFC 3339 strings
+// and data base64 strings, as they're written in XML plists.
+func parsePlist(data []byte) (interface{}, error) {
+	if bytes.HasPrefix(data, binaryPlistMagic) {
+		return parseBinaryPlist(data)
+	}
+	return parseXMLPlist(data)
+}
+
+/// Decodes the root value of an XML property list
+func parseXMLPlist(data []byte) (interface{}, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return nil, errors.New("no plist element found")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if start, ok := tok.(xml.StartElement); ok && start.Name.Local == "plist" {
+			start, err := nextStartElement(d)
+			if err != nil {
+				return nil, err
+			}
+			return decodePlistValue(d, start)
+		}
+	}
+}
+
+/// Skips to the next start element, failing on the end of its parent
+func nextStartElement(d *xml.Decoder) (xml.StartElement, error) {
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return xml.StartElement{}, err
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			return tok, nil
+		case xml.EndElement:
+			return xml.StartElement{}, fmt.Errorf("unexpected </%s>", tok.Name.Local)
+		}
+	}
+}
+
+// decodePlistValue decodes the element opened by start, consuming it up to
+// and including its end element
+func decodePlistValue(d *xml.Decoder, start xml.StartElement) (interface{}, error) {
+	switch start.Name.Local {
+	case "dict":
+		dict := map[string]interface{}{}
+		for {
+			key, err := plistDictKey(d)
+			if err != nil {
+				return nil, err
+			}
+			if key == nil {
+				return dict, nil
+			}
+			start, err := nextStartElement(d)
+			if err != nil {
+				return nil, err
+			}
+			if dict[*key], err = decodePlistValue(d, start); err != nil {
+				return nil, err
+			}
+		}
+	case "array":
+		array := []interface{}{}
+		for {
+			tok, err := d.Token()
+			if err != nil {
+				return nil, err
+			}
+			switch tok := tok.(type) {
+			case xml.StartElement:
+				value, err := decodePlistValue(d, tok)
+				if err != nil {
+					return nil, err
+				}
+				array = append(array, value)
+			case xml.EndElement:
+				return array, nil
+			}
+		}
+	case "true", "false":
+		return start.Name.Local == "true", d.Skip()
+	}
+
+	var text string
+	if err := d.DecodeElement(&text, &start); err != nil {
+		return nil, err
+	}
+	text = strings.TrimSpace(text)
+	switch start.Name.Local {
+	case "string", "date":
+		return text, nil
+	case "data":
+		return strings.Join(strings.Fields(text), ""), nil
+	case "integer":
+		return strconv.ParseInt(text, 10, 64)
+	case "real":
+		return strconv.ParseFloat(text, 64)
+	}
+	return nil, fmt.Errorf("unsupported plist element <%s>", start.Name.Local)
+}
+
+// plistDictKey reads the next `<key>` of a dictionary, returning nil at the
+// end of the dictionary
+func plistDictKey(d *xml.Decoder) (*string, error) {
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			if tok.Name.Local != "key" {
+				return nil, fmt.Errorf("expected <key> but found <%s>", tok.Name.Local)
+			}
+			var key string
+			if err := d.DecodeElement(&key, &tok); err != nil {
+				return nil, err
+			}
+			return &key, nil
+		case xml.EndElement:
+			return nil, nil
+		}
+	}
+}
+
+// binaryPlist holds the tables of a binary property list, whose objects are
+// found through an offset table and refer to each other by index
+type binaryPlist struct {
+	data    []byte
+	offsets []uint64
+	refSize int
+}
+
+/// Decodes the top object of a binary property list
+func parseBinaryPlist(data []byte) (interface{}, error) {
+	if len(data) < len(binaryPlistMagic)+32 {
+		return nil, errors.New("truncated binary plist")
+	}
+	trailer := data[len(data)-32:]
+	offsetSize := int(trailer[6])
+	refSize := int(trailer[7])
+	count := binary.BigEndian.Uint64(trailer[8:])
+	top := binary.BigEndian.Uint64(trailer[16:])
+	tableOffset := binary.BigEndian.Uint64(trailer[24:])
+	if offsetSize < 1 || offsetSize > 8 || refSize < 1 || refSize > 8 || top >= count {
+		return nil, errors.New("malformed binary plist trailer")
+	}
+	if tableOffset > uint64(len(data)) || count > (uint64(len(data))-tableOffset)/uint64(offsetSize) {
+		return nil, errors.New("binary plist offset table out of range")
+	}
+
+	p := binaryPlist{data: data, offsets: make([]uint64, count), refSize: refSize}
+	for i := range p.offsets {
+		start := int(tableOffset) + i*offsetSize
+		p.offsets[i] = readBigEndian(data[start : start+offsetSize])
+	}
+	return p.object(top, map[uint64]bool{}, 0)
+}
+
+/// Reads an unsigned big-endian integer of up to 8 bytes
+func readBigEndian(b []byte) uint64 {
+	var n uint64
+	for _, c := range b {
+		n = n<<8 | uint64(c)
+	}
+	return n
+}
+
+// object decodes the object at index ref. visiting holds the containers
+// being decoded, so that a reference cycle fails rather than recursing
+// forever.
+func (p binaryPlist) object(ref uint64, visiting map[uint64]bool, depth int) (interface{}, error) {
+	if ref >= uint64(len(p.offsets)) || p.offsets[ref] >= uint64(len(p.data)) {
+		return nil, fmt.Errorf("binary plist object %d out of range", ref)
+	}
+	offset := int(p.offsets[ref])
+	marker := p.data[offset]
+	kind, info := marker>>4, int(marker&0x0f)
+
+	switch kind {
+	case 0x0:
+		switch marker {
+		case 0x08:
+			return false, nil
+		case 0x09:
+			return true, nil
+		}
+		return nil, fmt.Errorf("unsupported binary plist marker 0x%02x", marker)
+	case 0x1:
+		b, err := p.bytes(offset+1, 1<<uint(info))
+		if err != nil {
+			return nil, err
+		}
+		switch len(b) {
+		case 8:
+			return int64(binary.BigEndian.Uint64(b)), nil
+		case 16:
+			// 128-bit integers only hold values that don't fit a signed int64
+			return int64(binary.BigEndian.Uint64(b[8:])), nil
+		}
+		return int64(readBigEndian(b)), nil
+	case 0x2, 0x3:
+		b, err := p.bytes(offset+1, 1<<uint(info))
+		if err != nil {
+			return nil, err
+		}
+		var f float64
+		switch len(b) {
+		case 4:
+			f = float64(math.Float32frombits(binary.BigEndian.Uint32(b)))
+		case 8:
+			f = math.Float64frombits(binary.BigEndian.Uint64(b))
+		default:
+			return nil, fmt.Errorf("unsupported binary plist real of %d bytes", len(b))
+		}
+		if kind == 0x3 {
+			seconds, fraction := math.Modf(f)
+			date := plistEpoch.Add(time.Duration(seconds)*time.Second + time.Duration(fraction*float64(time.Second)))
+			return date.Format(time.RFC3339), nil
+		}
+		return f, nil
+	}
+
+	count, start, err := p.count(offset, info)
+	if err != nil {
+		return nil, err
+	}
+	switch kind {
+	case 0x4:
+		b, err := p.bytes(start, count)
+		if err != nil {
+			return nil, err
+		}
+		return base64.StdEncoding.EncodeToString(b), nil
+	case 0x5:
+		b, err := p.bytes(start, count)
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	case 0x6:
+		b, err := p.bytes(start, count*2)
+		if err != nil {
+			return nil, err
+		}
+		units := make([]uint16, count)
+		for i := range units {
+			units[i] = binary.BigEndian.Uint16(b[i*2:])
+		}
+		return string(utf16.Decode(units)), nil
+	case 0xa, 0xd:
+		if visiting[ref] || depth >= maxPlistDepth {
+			return nil, errors.New("binary plist references are cyclic or nest too deeply")
+		}
+		visiting[ref] = true
+		defer delete(visiting, ref)
+
+		refCount := count
+		if kind == 0xd {
+			refCount *= 2
+		}
+		b, err := p.bytes(start, refCount*p.refSize)
+		if err != nil {
+			return nil, err
+		}
+		refs := make([]uint64, refCount)
+		for i := range refs {
+			refs[i] = readBigEndian(b[i*p.refSize : (i+1)*p.refSize])
+		}
+
+		if kind == 0xa {
+			array := make([]interface{}, count)
+			for i, ref := range refs {
+				if array[i], err = p.object(ref, visiting, depth+1); err != nil {
+					return nil, err
+				}
+			}
+			return array, nil
+		}
+		dict := make(map[string]interface{}, count)
+		for i := 0; i < count; i++ {
+			key, err := p.object(refs[i], visiting, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			name, ok := key.(string)
+			if !ok {
+				return nil, errors.New("binary plist dictionary key isn't a string")
+			}
+			if dict[name], err = p.object(refs[count+i], visiting, depth+1); err != nil {
+				return nil, err
+			}
+		}
+		return dict, nil
+	}
+	return nil, fmt.Errorf("unsupported binary plist marker 0x%02x", marker)
+}
+
+// count reads the length of a data, string or container object: the low
+// nibble of its marker, or when that's 0xf, the integer object that follows
+func (p binaryPlist) count(offset, info int) (int, int, error) {
+	if info != 0x0f {
+		return info, offset + 1, nil
+	}
+	b, err := p.bytes(offset+1, 1)
+	if err != nil {
+		return 0, 0, err
+	}
+	if b[0]>>4 != 0x1 || b[0]&0x0f > 3 {
+		return 0, 0, errors.New("malformed binary plist length")
+	}
+	size := 1 << (b[0] & 0x0f)
+	n, err := p.bytes(offset+2, size)
+	if err != nil {
+		return 0, 0, err
+	}
+	count := readBigEndian(n)
+	if count > uint64(len(p.data)) {
+		return 0, 0, errors.New("binary plist length out of range")
+	}
+	return int(count), offset + 2 + size, nil
+}
+
+/// Returns n bytes from offset, failing if they run past the end of the file
+func (p binaryPlist) bytes(offset, n int) ([]byte, error) {
+	if offset < 0 || n < 0 || offset+n > len(p.data) {
+		return nil, errors.New("truncated binary plist")
+	}
+	return p.data[offset : offset+n], nil
+}
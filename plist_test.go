@@ -0,0 +1,98 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParsePlist(t *testing.T) {
+	t.Parallel()
+	expected := map[string]interface{}{
+		"CFBundleIdentifier":           "com.example.ios",
+		"CFBundleShortVersionString":   "1.2.0",
+		"CFBundleVersion":              "42",
+		"CFBundleDisplayName":          "Ünïcödé App",
+		"CFBundleExecutable":           "App",
+		"LSRequiresIPhoneOS":           true,
+		"UIStatusBarHidden":            false,
+		"MinimumOSVersion":             "13.0",
+		"UIDeviceFamily":               []interface{}{int64(1), int64(2)},
+		"DTPlatformBuild":              int64(300),
+		"BuildMachineOSBuildScale":     1.5,
+		"LargeNumber":                  int64(1 << 40),
+		"NegativeNumber":               int64(-7),
+		"BuildDate":                    "2026-10-19T12:30:00Z",
+		"IconChecksum":                 "AAEC/w==",
+		"UIRequiredDeviceCapabilities": []interface{}{"arm64"},
+		"NSAppTransportSecurity": map[string]interface{}{
+			"NSAllowsArbitraryLoads": false,
+			"NSExceptionDomains":     map[string]interface{}{},
+		},
+	}
+
+	for _, name := range []string{"Info.xml.plist", "Info.binary.plist"} {
+		data, err := ioutil.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		plist, err := parsePlist(data)
+		if err != nil {
+			t.Errorf("Test failed: %s: %v", name, err)
+			continue
+		}
+		if !reflect.DeepEqual(plist, expected) {
+			t.Errorf("Test failed: %s: expected %+v but got %+v", name, expected, plist)
+		}
+	}
+}
+
+func TestParsePlist_Malformed(t *testing.T) {
+	t.Parallel()
+	// an array whose only element is itself
+	cyclic := append([]byte("bplist00"), 0xa1, 0x00, 0x08)
+	cyclic = append(cyclic, 0, 0, 0, 0, 0, 0, 1, 1)
+	cyclic = append(cyclic, 0, 0, 0, 0, 0, 0, 0, 1)
+	cyclic = append(cyclic, 0, 0, 0, 0, 0, 0, 0, 0)
+	cyclic = append(cyclic, 0, 0, 0, 0, 0, 0, 0, 10)
+
+	binary, err := ioutil.ReadFile(filepath.Join("testdata", "Info.binary.plist"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		data []byte
+		err  string
+	}{
+		{data: cyclic, err: "cyclic"},
+		{data: binary[:len(binary)-8], err: "binary plist"},
+		{data: []byte("<plist><dict><string>no key</string></dict></plist>"), err: "expected <key>"},
+		{data: []byte("<html></html>"), err: "no plist element"},
+	}
+	for _, test := range tests {
+		if _, err := parsePlist(test.data); err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("Test failed: expected an error containing %q but got %v", test.err, err)
+		}
+	}
+}
+
+func TestIosAppVersion_BinaryPlist(t *testing.T) {
+	t.Parallel()
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "Info.binary.plist"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ipa := filepath.Join(t.TempDir(), "App.ipa")
+	writeTestZip(t, ipa, map[string][]byte{"Payload/App.app/Info.plist": data})
+
+	version, err := iosAppVersion(ipa)
+	if err != nil {
+		t.Fatalf("Test failed: %v", err)
+	}
+	if expected := (AppVersion{ID: "com.example.ios", Version: "1.2.0", Build: "42"}); version != expected {
+		t.Errorf("Test failed: expected %+v but got %+v", expected, version)
+	}
+}
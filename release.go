@@ -0,0 +1,194 @@
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+/// Largest manifest or Info.plist read into memory from an archive
+const maxMetadataSize = 16 << 20
+
+// AppVersion identifies a build of an app: its bundle identifier or
+// applicationId, its user-facing version and its build number
+type AppVersion struct {
+	ID      string
+	Version string
+	Build   string
+}
+
+// ReleaseName formats the version as a Sentry release name,
+// `package@version+build`, leaving out the build when there's none
+func (v AppVersion) ReleaseName() string {
+	name := v.ID + "@" + v.Version
+	if v.Build != "" {
+		name += "+" + v.Build
+	}
+	return name
+}
+
+// deriveRelease reads the release name from the metadata of the built app:
+// `archive_path` for iOS and `android_app_path` for Android, in that order
+// when both platforms are selected. Without an Android app path, the Gradle
+// output metadata of the mapping files' variants is used. An empty name is
+// returned when none of these are available.
+func deriveRelease(cfg Config) (string, error) {
+	if cfg.SelectedPlatform != PlatformAndroid && cfg.ArchivePath != "" {
+		version, err := iosAppVersion(cfg.ArchivePath)
+		if err != nil {
+			return "", err
+		}
+		return version.ReleaseName(), nil
+	}
+	if cfg.SelectedPlatform != PlatformIOS && cfg.AndroidAppPath != "" {
+		version, err := androidAppVersion(cfg.AndroidAppPath)
+		if err != nil {
+			return "", err
+		}
+		return version.ReleaseName(), nil
+	}
+	if cfg.SelectedPlatform != PlatformIOS && cfg.ProguardPath != "" {
+		mappings, _ := resolveMappings(cfg.ProguardPath, splitList(cfg.AndroidVariants))
+		for _, mapping := range mappings {
+			if version, ok := mappingAppVersion(mapping); ok {
+				return version.ReleaseName(), nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// resolveRelease fills in `release` from the app metadata when it isn't set.
+// Failing to read the metadata only warns, as the release is only needed by
+// some of the jobs.
+func resolveRelease(cfg *Config) {
+	if cfg.Release != "" {
+		return
+	}
+	release, err := deriveRelease(*cfg)
+	if err != nil {
+		logger.Warnf("failed to derive the release name: %s", err)
+		return
+	}
+	if release != "" {
+		cfg.Release = release
+		logger.Printf("Release: %s (from app metadata)", release)
+	}
+}
+
+// iosAppVersion reads the version of the app in an .xcarchive, an .ipa or a
+// bare .app bundle from its Info.plist
+func iosAppVersion(archivePath string) (AppVersion, error) {
+	var data []byte
+	var err error
+	key := ""
+	switch strings.ToLower(filepath.Ext(archivePath)) {
+	case ".xcarchive":
+		// the archive's own Info.plist copies the app's under this key
+		key = "ApplicationProperties"
+		data, err = ioutil.ReadFile(filepath.Join(archivePath, "Info.plist"))
+	case ".app":
+		data, err = ioutil.ReadFile(filepath.Join(archivePath, "Info.plist"))
+	case ".ipa":
+		data, err = readZipEntry(archivePath, func(name string) bool {
+			parts := strings.Split(name, "/")
+			return len(parts) == 3 && parts[0] == "Payload" && strings.HasSuffix(parts[1], ".app") && parts[2] == "Info.plist"
+		})
+	default:
+		return AppVersion{}, fmt.Errorf("unsupported archive type: %s", archivePath)
+	}
+	if err != nil {
+		return AppVersion{}, err
+	}
+
+	plist, err := parsePlist(data)
+	if err != nil {
+		return AppVersion{}, fmt.Errorf("failed to read the Info.plist of %s: %v", archivePath, err)
+	}
+	dict, _ := plist.(map[string]interface{})
+	if key != "" {
+		dict, _ = dict[key].(map[string]interface{})
+	}
+	str := func(key string) string {
+		s, _ := dict[key].(string)
+		return s
+	}
+	version := AppVersion{
+		ID:      str("CFBundleIdentifier"),
+		Version: str("CFBundleShortVersionString"),
+		Build:   str("CFBundleVersion"),
+	}
+	if version.ID == "" || version.Version == "" {
+		return version, fmt.Errorf("no CFBundleIdentifier or CFBundleShortVersionString found for %s", archivePath)
+	}
+	return version, nil
+}
+
+// androidAppVersion reads the applicationId, versionName and versionCode from
+// the manifest of an .apk or an .aab, or from a Gradle output-metadata.json
+func androidAppVersion(appPath string) (AppVersion, error) {
+	var attributes map[string]string
+	switch strings.ToLower(filepath.Ext(appPath)) {
+	case ".apk":
+		data, err := readZipEntry(appPath, func(name string) bool { return name == "AndroidManifest.xml" })
+		if err != nil {
+			return AppVersion{}, err
+		}
+		if attributes, err = manifestAttributes(data); err != nil {
+			return AppVersion{}, fmt.Errorf("failed to read the manifest of %s: %v", appPath, err)
+		}
+	case ".aab":
+		data, err := readZipEntry(appPath, func(name string) bool { return name == "base/manifest/AndroidManifest.xml" })
+		if err != nil {
+			return AppVersion{}, err
+		}
+		if attributes, err = protoManifestAttributes(data); err != nil {
+			return AppVersion{}, fmt.Errorf("failed to read the manifest of %s: %v", appPath, err)
+		}
+	case ".json":
+		metadata, err := readOutputMetadata(appPath)
+		if err != nil {
+			return AppVersion{}, err
+		}
+		return metadata.AppVersion()
+	default:
+		return AppVersion{}, fmt.Errorf("unsupported Android app type: %s", appPath)
+	}
+
+	version := AppVersion{
+		ID:      attributes["package"],
+		Version: attributes["versionName"],
+		Build:   attributes["versionCode"],
+	}
+	if version.ID == "" || version.Version == "" {
+		return version, fmt.Errorf("no package or versionName found in the manifest of %s", appPath)
+	}
+	return version, nil
+}
+
+/// Reads the first entry of a zip archive accepted by match
+func readZipEntry(path string, match func(name string) bool) ([]byte, error) {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	for _, f := range r.File {
+		if !match(f.Name) {
+			continue
+		}
+		if f.UncompressedSize64 > maxMetadataSize {
+			return nil, fmt.Errorf("%s is too large to inspect", f.Name)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return ioutil.ReadAll(rc)
+	}
+	return nil, fmt.Errorf("no matching entry found in %s", path)
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/binary"
+	"path/filepath"
+	"testing"
+	"unicode/utf16"
+)
+
+/// Builds an XML Info.plist, nesting the app keys under key when not empty
+func testInfoPlist(key, id, version, build string) []byte {
+	dict := "<dict><key>CFBundleIdentifier</key><string>" + id + "</string>" +
+		"<key>CFBundleShortVersionString</key><string>" + version + "</string>" +
+		"<key>CFBundleVersion</key><string>" + build + "</string>" +
+		"<key>UIRequiredDeviceCapabilities</key><array><string>arm64</string></array>" +
+		"<key>LSRequiresIPhoneOS</key><true/></dict>"
+	if key != "" {
+		dict = "<dict><key>ArchiveVersion</key><integer>2</integer><key>" + key + "</key>" + dict + "</dict>"
+	}
+	return []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">` + dict + `</plist>`)
+}
+
+// testAXML builds a binary AndroidManifest.xml holding only the `<manifest>`
+// element, with versionCode identified by its resource ID as aapt does
+func testAXML(pkg, versionName string, versionCode uint32) []byte {
+	le := binary.LittleEndian
+	pool := []string{"versionCode", "versionName", "package", "manifest", pkg, versionName, "http://schemas.android.com/apk/res/android"}
+
+	var data []byte
+	for _, s := range pool {
+		units := utf16.Encode([]rune(s))
+		entry := make([]byte, 2+len(units)*2+2)
+		le.PutUint16(entry, uint16(len(units)))
+		for i, u := range units {
+			le.PutUint16(entry[2+i*2:], u)
+		}
+		data = append(data, entry...)
+	}
+	for len(data)%4 != 0 {
+		data = append(data, 0)
+	}
+	stringPool := make([]byte, 28+len(pool)*4)
+	le.PutUint16(stringPool[0:], axmlStringPoolType)
+	le.PutUint16(stringPool[2:], 28)
+	le.PutUint32(stringPool[4:], uint32(len(stringPool)+len(data)))
+	le.PutUint32(stringPool[8:], uint32(len(pool)))
+	le.PutUint32(stringPool[20:], uint32(len(stringPool)))
+	offset := 0
+	for i, s := range pool {
+		le.PutUint32(stringPool[28+i*4:], uint32(offset))
+		offset += 2 + len(utf16.Encode([]rune(s)))*2 + 2
+	}
+	stringPool = append(stringPool, data...)
+
+	resourceMap := make([]byte, 16)
+	le.PutUint16(resourceMap[0:], axmlResourceMapType)
+	le.PutUint16(resourceMap[2:], 8)
+	le.PutUint32(resourceMap[4:], 16)
+	le.PutUint32(resourceMap[8:], 0x0101021b)
+	le.PutUint32(resourceMap[12:], 0x0101021c)
+
+	element := make([]byte, 16+20+3*20)
+	le.PutUint16(element[0:], axmlStartElementType)
+	le.PutUint16(element[2:], 16)
+	le.PutUint32(element[4:], uint32(len(element)))
+	le.PutUint32(element[12:], 0xffffffff)
+	le.PutUint32(element[16:], 0xffffffff)
+	le.PutUint32(element[20:], 3)
+	le.PutUint16(element[24:], 20)
+	le.PutUint16(element[26:], 20)
+	le.PutUint16(element[28:], 3)
+	attributes := [][5]uint32{
+		// namespace, name, raw value, data type, data
+		{6, 0, 0xffffffff, axmlTypeIntDec, versionCode},
+		{6, 1, 5, axmlTypeString, 5},
+		{0xffffffff, 2, 4, axmlTypeString, 4},
+	}
+	for i, attr := range attributes {
+		a := element[36+i*20:]
+		le.PutUint32(a[0:], attr[0])
+		le.PutUint32(a[4:], attr[1])
+		le.PutUint32(a[8:], attr[2])
+		le.PutUint16(a[12:], 8)
+		a[15] = byte(attr[3])
+		le.PutUint32(a[16:], attr[4])
+	}
+
+	file := make([]byte, 8)
+	le.PutUint16(file[0:], axmlFileType)
+	le.PutUint16(file[2:], 8)
+	file = append(file, stringPool...)
+	file = append(file, resourceMap...)
+	file = append(file, element...)
+	le.PutUint32(file[4:], uint32(len(file)))
+	return file
+}
+
+/// Appends v to b as a protocol buffer varint
+func appendUvarint(b []byte, v uint64) []byte {
+	buf := make([]byte, binary.MaxVarintLen64)
+	return append(b, buf[:binary.PutUvarint(buf, v)]...)
+}
+
+/// Encodes a length-delimited protocol buffer field
+func protoBytes(field int, value []byte) []byte {
+	b := appendUvarint(nil, uint64(field<<3|2))
+	b = appendUvarint(b, uint64(len(value)))
+	return append(b, value...)
+}
+
+/// Encodes a varint protocol buffer field
+func protoVarint(field int, value uint64) []byte {
+	return appendUvarint(appendUvarint(nil, uint64(field<<3)), value)
+}
+
+// testProtoManifest builds an aapt2 `XmlNode` manifest as found in an .aab,
+// with versionCode compiled to an integer
+func testProtoManifest(pkg, versionName string, versionCode uint64) []byte {
+	var element []byte
+	element = append(element, protoBytes(3, []byte("manifest"))...)
+	element = append(element, protoBytes(4, append(protoBytes(2, []byte("package")), protoBytes(3, []byte(pkg))...))...)
+	element = append(element, protoBytes(4, append(protoBytes(2, []byte("versionName")), protoBytes(3, []byte(versionName))...))...)
+
+	var code []byte
+	code = append(code, protoBytes(1, []byte("http://schemas.android.com/apk/res/android"))...)
+	code = append(code, protoBytes(2, []byte("versionCode"))...)
+	code = append(code, protoVarint(5, 0x0101021b)...)
+	code = append(code, protoBytes(6, protoBytes(7, protoVarint(6, versionCode)))...)
+	element = append(element, protoBytes(4, code)...)
+	return protoBytes(1, element)
+}
+
+func TestDeriveRelease(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "App.xcarchive", "Info.plist"), testInfoPlist("ApplicationProperties", "com.example.ios", "1.2.0", "42"))
+	writeTestFile(t, filepath.Join(dir, "App.app", "Info.plist"), testInfoPlist("", "com.example.ios", "1.2.0", ""))
+	writeTestZip(t, filepath.Join(dir, "app.apk"), map[string][]byte{"AndroidManifest.xml": testAXML("com.example.android", "2.0.1", 201)})
+	writeTestZip(t, filepath.Join(dir, "app.aab"), map[string][]byte{"base/manifest/AndroidManifest.xml": testProtoManifest("com.example.android", "2.0.1", 201)})
+
+	var tests = []struct {
+		cfg      Config
+		expected string
+	}{
+		{
+			cfg:      Config{SelectedPlatform: PlatformIOS, ArchivePath: filepath.Join(dir, "App.xcarchive")},
+			expected: "com.example.ios@1.2.0+42",
+		},
+		{
+			cfg:      Config{SelectedPlatform: PlatformBoth, ArchivePath: filepath.Join(dir, "App.app"), AndroidAppPath: filepath.Join(dir, "app.apk")},
+			expected: "com.example.ios@1.2.0",
+		},
+		{
+			cfg:      Config{SelectedPlatform: PlatformAndroid, ArchivePath: filepath.Join(dir, "App.app"), AndroidAppPath: filepath.Join(dir, "app.apk")},
+			expected: "com.example.android@2.0.1+201",
+		},
+		{
+			cfg:      Config{SelectedPlatform: PlatformAndroid, AndroidAppPath: filepath.Join(dir, "app.aab")},
+			expected: "com.example.android@2.0.1+201",
+		},
+		{
+			cfg:      Config{SelectedPlatform: PlatformBoth},
+			expected: "",
+		},
+	}
+
+	for _, test := range tests {
+		release, err := deriveRelease(test.cfg)
+		if err != nil {
+			t.Errorf("Test failed: %v", err)
+		}
+		if release != test.expected {
+			t.Errorf("Test failed: expected %q but got %q", test.expected, release)
+		}
+	}
+
+	writeTestFile(t, filepath.Join(dir, "Empty.app", "Info.plist"), testInfoPlist("", "", "", ""))
+	if _, err := deriveRelease(Config{SelectedPlatform: PlatformIOS, ArchivePath: filepath.Join(dir, "Empty.app")}); err == nil {
+		t.Error("Test failed: expected an Info.plist without a version to fail")
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Job statuses recorded in the upload report
+const (
+	StatusUploaded = "uploaded"
+	StatusFailed   = "failed"
+	StatusMissing  = "missing"
+	StatusSkipped  = "skipped"
+	StatusNotRun   = "not run"
+	StatusVerified = "verified"
+)
+
+// Bitrise outputs exported once the run finishes
+const (
+	outputStatus  = "SENTRY_UPLOAD_STATUS"
+	outputSummary = "SENTRY_UPLOAD_SUMMARY"
+)
+
+// JobResult records what happened to a single job of the plan
+type JobResult struct {
+	Job      UploadJob
+	Status   string
+	Reason   string
+	Output   []byte
+	Duration time.Duration
+}
+
+// Report collects the result of every job of an executed plan
+type Report struct {
+	Results []JobResult
+}
+
+// Failed returns the first failed job, if any
+func (r Report) Failed() (JobResult, bool) {
+	for _, result := range r.Results {
+		if result.Status == StatusFailed {
+			return result, true
+		}
+	}
+	return JobResult{}, false
+}
+
+// Status is `failed` if any job failed and `success` otherwise
+func (r Report) Status() string {
+	if _, failed := r.Failed(); failed {
+		return "failed"
+	}
+	return "success"
+}
+
+// Summary lists one `id: status` line per job, with the app version and the
+// reason if any. Mapping uploads are identified by their build variant.
+func (r Report) Summary() string {
+	lines := []string{}
+	for _, result := range r.Results {
+		lines = append(lines, result.describe())
+	}
+	return strings.Join(lines, "\n")
+}
+
+/// Formats a result as `id: status`, followed by the app version and reason
+func (r JobResult) describe() string {
+	line := fmt.Sprintf("%s: %s", r.Job.ID, r.Status)
+	if r.Job.App.ID != "" {
+		line += " for " + r.Job.App.ReleaseName()
+	}
+	if r.Reason != "" {
+		line += fmt.Sprintf(" (%s)", r.Reason)
+	}
+	return line
+}
+
+/// Prints the summary, highlighting jobs that didn't upload
+func printReport(r Report) {
+	logger.Section("Summary")
+	for _, result := range r.Results {
+		line := "- " + result.describe()
+		if result.Duration > 0 {
+			line += fmt.Sprintf(" in %s", result.Duration.Round(time.Millisecond))
+		}
+		switch result.Status {
+		case StatusUploaded, StatusVerified:
+			logger.Donef("%s", line)
+		case StatusFailed:
+			logger.Errorf("%s", strings.TrimPrefix(line, "- "))
+		case StatusMissing:
+			logger.Warnf("%s", strings.TrimPrefix(line, "- "))
+		default:
+			logger.Printf("%s", line)
+		}
+	}
+}
+
+// exportOutputs exposes the report as Bitrise step outputs through envman
+func exportOutputs(r Report, cmd CommandExecutor) error {
+	outputs := [][2]string{
+		{outputStatus, r.Status()},
+		{outputSummary, r.Summary()},
+	}
+	for _, output := range outputs {
+		if out, err := cmd.execute(newInvocation("envman", "add", "--key", output[0], "--value", output[1])); err != nil {
+			return fmt.Errorf("failed to export %s: %v: %s", output[0], err, out)
+		}
+	}
+	return nil
+}
@@ -1,5 +1,10 @@
 package main
 
+import (
+	"fmt"
+	"strings"
+)
+
 const sentryCli = "sentry-cli"
 
 /// `sentry-cli` command to upload dSYM file
@@ -8,25 +13,93 @@ const uploadDifCmd = "upload-dif"
 /// `sentry-cli` command to upload proguard mapping
 const uploadProguardCmd = "upload-proguard"
 
+/// `sentry-cli` command to record a deploy of a release
+const deployCmd = "deploy"
+
+/// `sentry-cli` command to upload an app build for size analysis
+const buildUploadCmd = "build-upload"
+
 /// `sentry-cli` arg to enable debug logs
 const logDebugArg = "--log-level=debug"
 
-// SentryCommand allows the upload function to send to execute either
-// `upload-proguard` or `upload-dif`
-type SentryCommand struct {
-	Command  string
-	FilePath string
+// commandSpelling is how a command is invoked from a given sentry-cli release
+// onwards
+type commandSpelling struct {
+	since Version
+	args  []string
+}
+
+// commandSpellings lists, newest first, how each command is spelled across
+// sentry-cli releases. `upload-dif` became `debug-files upload` in 2.0.0 and
+// is only kept there as a deprecated alias; `upload-proguard` hasn't been
+// renamed. Deploys are a subcommand of `releases` in every release, while
+// `build upload` only exists from 2.52.0.
+var commandSpellings = map[string][]commandSpelling{
+	uploadDifCmd: {
+		{since: Version{2, 0, 0}, args: []string{"debug-files", "upload"}},
+		{since: Version{}, args: []string{uploadDifCmd}},
+	},
+	uploadProguardCmd: {
+		{since: Version{}, args: []string{uploadProguardCmd}},
+	},
+	deployCmd: {
+		{since: Version{}, args: []string{"releases", "deploys"}},
+	},
+	buildUploadCmd: {
+		{since: Version{2, 52, 0}, args: []string{"build", "upload"}},
+	},
+}
+
+/// Returns the arguments invoking command on the given sentry-cli version
+func commandArgs(command string, version Version) []string {
+	for _, spelling := range commandSpellings[command] {
+		if !version.Less(spelling.since) {
+			return spelling.args
+		}
+	}
+	return []string{command}
 }
 
-/// Builds the sentry-cli command string with the given args
-func buildSentryArgs(cfg Config, command string) []string {
-	return []string{
+/// Fails for a command the given sentry-cli version predates
+func checkCommandSupported(command string, version Version) error {
+	spellings := commandSpellings[command]
+	if len(spellings) == 0 {
+		return nil
+	}
+	oldest := spellings[len(spellings)-1]
+	if version.Less(oldest.since) {
+		return fmt.Errorf("sentry-cli %s doesn't support `%s`, %s or later is required", version, strings.Join(oldest.args, " "), oldest.since)
+	}
+	return nil
+}
+
+/// Builds the sentry-cli command string with the given args, passing
+/// `--project` once per project; `project_slug` is used when none are given.
+/// Only `releases` commands take several, uploads are split by project.
+/// `custom_headers` are passed as global `--header` options
+func buildSentryArgs(cfg Config, cli SentryCli, command string, projects []string) []string {
+	if len(projects) == 0 {
+		projects = splitList(cfg.ProjectSlug)
+	}
+	args := []string{}
+	if cfg.SentryURL != "" {
+		args = append(args, "--url", cfg.SentryURL)
+	}
+	args = append(args,
 		"--auth-token",
-		cfg.AuthToken,
-		command,
+		string(cfg.AuthToken),
+	)
+	headers, _ := cfg.CustomHeaders.Pairs()
+	for _, header := range headers {
+		args = append(args, "--header", header)
+	}
+	args = append(args, commandArgs(command, cli.Version)...)
+	args = append(args,
 		"--org",
 		cfg.OrgSlug,
-		"--project",
-		cfg.ProjectSlug,
+	)
+	for _, project := range projects {
+		args = append(args, "--project", project)
 	}
+	return args
 }
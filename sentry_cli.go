@@ -0,0 +1,183 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+)
+
+/// Oldest sentry-cli release the step supports
+var minSentryCliVersion = Version{1, 60, 0}
+
+/// sentry-cli release installed when no binary can be found
+const pinnedSentryCliVersion = "2.52.0"
+
+/// Download location of the sentry-cli release binaries
+const sentryCliDownloadURL = "https://downloads.sentry-cdn.com/sentry-cli/%s/sentry-cli-%s"
+
+// sentryCliChecksums pins the SHA-256 of the pinnedSentryCliVersion binary
+// for each asset named by sentryCliAssetName. Downloads of assets without a
+// checksum here are refused, so it has to be updated along with the version.
+var sentryCliChecksums = map[string]string{}
+
+var versionPattern = regexp.MustCompile(`(\d+)\.(\d+)\.(\d+)`)
+
+// Version is a parsed `major.minor.patch` release number
+type Version struct {
+	Major int
+	Minor int
+	Patch int
+}
+
+/// Parses the first `x.y.z` found in s, e.g. the output of `sentry-cli --version`
+func parseVersion(s string) (Version, error) {
+	match := versionPattern.FindStringSubmatch(s)
+	if match == nil {
+		return Version{}, fmt.Errorf("no version found in %q", s)
+	}
+	major, _ := strconv.Atoi(match[1])
+	minor, _ := strconv.Atoi(match[2])
+	patch, _ := strconv.Atoi(match[3])
+	return Version{major, minor, patch}, nil
+}
+
+// Less reports whether v is an older release than other
+func (v Version) Less(other Version) bool {
+	if v.Major != other.Major {
+		return v.Major < other.Major
+	}
+	if v.Minor != other.Minor {
+		return v.Minor < other.Minor
+	}
+	return v.Patch < other.Patch
+}
+
+// String formats v as `major.minor.patch`
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// SentryCli is the sentry-cli binary the uploads will be run with
+type SentryCli struct {
+	Path    string
+	Version Version
+}
+
+// resolveSentryCli locates sentry-cli, looking in order at the
+// `sentry_cli_path` input, PATH and the local install directory, and
+// downloads the pinned release into the install directory as a last resort.
+// The binary found is rejected if it's older than minSentryCliVersion.
+func resolveSentryCli(cfg Config, cmd CommandExecutor, transport http.RoundTripper) (SentryCli, error) {
+	path, err := findSentryCli(cfg, transport)
+	if err != nil {
+		return SentryCli{}, err
+	}
+
+	out, err := cmd.execute(newInvocation(path, "--version"))
+	if err != nil {
+		return SentryCli{}, fmt.Errorf("failed to run %s --version: %v: %s", path, err, out)
+	}
+	version, err := parseVersion(string(out))
+	if err != nil {
+		return SentryCli{}, fmt.Errorf("failed to read the version of %s: %v", path, err)
+	}
+	if version.Less(minSentryCliVersion) {
+		return SentryCli{}, fmt.Errorf("sentry-cli %s at %s is too old, version %s or newer is required", version, path, minSentryCliVersion)
+	}
+	return SentryCli{Path: path, Version: version}, nil
+}
+
+/// Returns the path of the first sentry-cli found, downloading it if needed
+func findSentryCli(cfg Config, transport http.RoundTripper) (string, error) {
+	if cfg.SentryCliPath != "" {
+		if _, err := os.Stat(cfg.SentryCliPath); err != nil {
+			return "", fmt.Errorf("sentry_cli_path %s not found: %v", cfg.SentryCliPath, err)
+		}
+		return cfg.SentryCliPath, nil
+	}
+	if path, err := exec.LookPath(sentryCli); err == nil {
+		return path, nil
+	}
+	if cfg.SentryCliInstallDir == "" {
+		return "", fmt.Errorf("%s not found in PATH and no sentry_cli_install_dir is set", sentryCli)
+	}
+
+	installed := filepath.Join(cfg.SentryCliInstallDir, sentryCli)
+	if _, err := os.Stat(installed); err == nil {
+		return installed, nil
+	}
+	asset, err := sentryCliAssetName()
+	if err != nil {
+		return "", err
+	}
+	checksum, ok := sentryCliChecksums[asset]
+	if !ok {
+		return "", fmt.Errorf("%s not found and no checksum is pinned for the %s %s release, install it or set sentry_cli_path", sentryCli, pinnedSentryCliVersion, asset)
+	}
+	logger.Printf("%s not found, installing %s into %s...", sentryCli, pinnedSentryCliVersion, cfg.SentryCliInstallDir)
+	url := fmt.Sprintf(sentryCliDownloadURL, pinnedSentryCliVersion, asset)
+	if err := downloadSentryCli(url, checksum, installed, transport); err != nil {
+		return "", fmt.Errorf("failed to install %s: %v", sentryCli, err)
+	}
+	return installed, nil
+}
+
+/// Names the release binary matching the current OS and architecture
+func sentryCliAssetName() (string, error) {
+	switch runtime.GOOS {
+	case "darwin":
+		return "Darwin-universal", nil
+	case "linux":
+		switch runtime.GOARCH {
+		case "amd64":
+			return "Linux-x86_64", nil
+		case "arm64":
+			return "Linux-aarch64", nil
+		}
+	}
+	return "", fmt.Errorf("no sentry-cli release available for %s/%s", runtime.GOOS, runtime.GOARCH)
+}
+
+// downloadSentryCli downloads the sentry-cli binary at url to dest and makes
+// it executable, once its SHA-256 matches checksum
+func downloadSentryCli(url, checksum, dest string, transport http.RoundTripper) error {
+	client := http.Client{Transport: transport}
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("download failed: %s", resp.Status)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	tmp := dest + ".download"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return err
+	}
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(f, hash), resp.Body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if sum := hex.EncodeToString(hash.Sum(nil)); err == nil && sum != checksum {
+		err = fmt.Errorf("checksum mismatch for %s: expected sha256 %s but got %s", url, checksum, sum)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, dest)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestResolveSentryCli(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), sentryCli)
+	writeTestFile(t, path, []byte("#!/bin/sh\n"))
+
+	var tests = []struct {
+		out      string
+		expected Version
+		err      string
+	}{
+		{out: "sentry-cli 2.21.2\n", expected: Version{2, 21, 2}},
+		{out: "sentry-cli 1.60.0\n", expected: Version{1, 60, 0}},
+		{out: "sentry-cli 1.59.9\n", err: "too old"},
+		{out: "command not found\n", err: "failed to read the version"},
+	}
+
+	for _, test := range tests {
+		cmd := respondWith(test.out)
+		cli, err := resolveSentryCli(Config{SentryCliPath: path}, cmd, http.DefaultTransport)
+		if calls := cmd.Calls(); len(calls) != 1 || !reflect.DeepEqual(calls[0], newInvocation(path, "--version")) {
+			t.Errorf("Test failed: expected %s --version but got %+v", path, calls)
+		}
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("Test failed: expected error %q but got %v", test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test failed: %v", err)
+		}
+		if cli.Path != path || cli.Version != test.expected {
+			t.Errorf("Test failed: expected %s %s but got %s %s", path, test.expected, cli.Path, cli.Version)
+		}
+	}
+}
+
+func TestCommandArgs(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		version  string
+		command  string
+		expected []string
+	}{
+		{"sentry-cli 1.60.0", uploadDifCmd, []string{"upload-dif"}},
+		{"sentry-cli 1.74.6", uploadDifCmd, []string{"upload-dif"}},
+		{"sentry-cli 2.0.0", uploadDifCmd, []string{"debug-files", "upload"}},
+		{"sentry-cli 2.21.2", uploadDifCmd, []string{"debug-files", "upload"}},
+		{"sentry-cli 10.0.0", uploadDifCmd, []string{"debug-files", "upload"}},
+		{"sentry-cli 1.60.0", uploadProguardCmd, []string{"upload-proguard"}},
+		{"sentry-cli 2.21.2", uploadProguardCmd, []string{"upload-proguard"}},
+	}
+
+	for _, test := range tests {
+		version, err := parseVersion(test.version)
+		if err != nil {
+			t.Fatalf("Test failed: %v", err)
+		}
+		args := commandArgs(test.command, version)
+		if !reflect.DeepEqual(args, test.expected) {
+			t.Errorf("Test failed: %s on %s expected %v but got %v", test.command, test.version, test.expected, args)
+		}
+	}
+}
+
+func TestDownloadSentryCli(t *testing.T) {
+	t.Parallel()
+	binary := []byte("#!/bin/sh\necho sentry-cli 2.52.0\n")
+	sum := sha256.Sum256(binary)
+	checksum := hex.EncodeToString(sum[:])
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(binary)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	dest := filepath.Join(dir, "verified", sentryCli)
+	if err := downloadSentryCli(server.URL, checksum, dest, http.DefaultTransport); err != nil {
+		t.Fatalf("Test failed: %v", err)
+	}
+	if data, err := ioutil.ReadFile(dest); err != nil || string(data) != string(binary) {
+		t.Errorf("Test failed: expected the downloaded binary at %s but got %q, %v", dest, data, err)
+	}
+
+	dest = filepath.Join(dir, "tampered", sentryCli)
+	err := downloadSentryCli(server.URL, strings.Repeat("0", 64), dest, http.DefaultTransport)
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("Test failed: expected a checksum mismatch but got %v", err)
+	}
+	for _, path := range []string{dest, dest + ".download"} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("Test failed: expected %s not to be installed", path)
+		}
+	}
+}
+
+// not parallel, as it swaps PATH and the pinned checksums
+func TestFindSentryCli_Install(t *testing.T) {
+	asset, err := sentryCliAssetName()
+	if err != nil {
+		t.Skip(err)
+	}
+	binary := []byte("#!/bin/sh\necho sentry-cli " + pinnedSentryCliVersion + "\n")
+	sum := sha256.Sum256(binary)
+
+	checksums := sentryCliChecksums
+	sentryCliChecksums = map[string]string{asset: hex.EncodeToString(sum[:])}
+	defer func() { sentryCliChecksums = checksums }()
+	path := os.Getenv("PATH")
+	if err := os.Setenv("PATH", t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv("PATH", path)
+
+	var requested []string
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		requested = append(requested, req.URL.String())
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Status:     "200 OK",
+			Body:       ioutil.NopCloser(bytes.NewReader(binary)),
+			Request:    req,
+		}, nil
+	})
+
+	installDir := filepath.Join(t.TempDir(), "bin")
+	installed, err := findSentryCli(Config{SentryCliInstallDir: installDir}, transport)
+	if err != nil {
+		t.Fatalf("Test failed: %v", err)
+	}
+	expectedURL := fmt.Sprintf(sentryCliDownloadURL, pinnedSentryCliVersion, asset)
+	if installed != filepath.Join(installDir, sentryCli) || !reflect.DeepEqual(requested, []string{expectedURL}) {
+		t.Errorf("Test failed: expected %s downloaded from %s but got %s from %v", filepath.Join(installDir, sentryCli), expectedURL, installed, requested)
+	}
+	if data, err := ioutil.ReadFile(installed); err != nil || !bytes.Equal(data, binary) {
+		t.Errorf("Test failed: expected the downloaded binary at %s but got %q, %v", installed, data, err)
+	}
+
+	// the installed binary is reused rather than downloaded again
+	if _, err := findSentryCli(Config{SentryCliInstallDir: installDir}, transport); err != nil || len(requested) != 1 {
+		t.Errorf("Test failed: expected the installed binary to be reused but got %v after %v", err, requested)
+	}
+}
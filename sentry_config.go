@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+)
+
+/// Sentry server used when no URL is configured anywhere
+const defaultSentryURL = "https://sentry.io/"
+
+/// Config files looked up in the working directory when no path is given
+var defaultSentryConfigFiles = []string{"sentry.properties", ".sentryclirc"}
+
+// Provenance records where a merged config value came from
+type Provenance struct {
+	Input  string
+	Value  string
+	Source string
+}
+
+// sentryConfigKeys maps the `section.key` names shared by .sentryclirc and
+// sentry.properties to the step inputs they provide defaults for
+var sentryConfigKeys = []struct {
+	key   string
+	input string
+	field func(*Config) *string
+}{
+	{"defaults.url", "sentry_url", func(c *Config) *string { return &c.SentryURL }},
+	{"defaults.org", "org_slug", func(c *Config) *string { return &c.OrgSlug }},
+	{"defaults.project", "project_slug", func(c *Config) *string { return &c.ProjectSlug }},
+	{"auth.token", "auth_token", func(c *Config) *string { return (*string)(&c.AuthToken) }},
+}
+
+// mergeSentryConfig fills the Sentry URL, org, project and token left empty
+// by the step inputs from the given .sentryclirc / sentry.properties files,
+// earlier files taking precedence over later ones. When no paths are given
+// the default files are read from the working directory if they exist.
+func mergeSentryConfig(cfg *Config, paths []string) ([]Provenance, error) {
+	if len(paths) == 0 {
+		for _, name := range defaultSentryConfigFiles {
+			if _, err := os.Stat(name); err == nil {
+				paths = append(paths, name)
+			}
+		}
+	}
+
+	files := make([]map[string]string, len(paths))
+	for i, path := range paths {
+		values, err := readSentryConfigFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", path, err)
+		}
+		files[i] = values
+	}
+
+	provenance := []Provenance{}
+	for _, k := range sentryConfigKeys {
+		field := k.field(cfg)
+		source := "step input"
+		if *field == "" {
+			source = "unset"
+			for i, values := range files {
+				if value := values[k.key]; value != "" {
+					*field = value
+					source = paths[i]
+					break
+				}
+			}
+		}
+		if *field == "" && k.input == "sentry_url" {
+			*field = defaultSentryURL
+			source = "default"
+		}
+
+		value := *field
+		if k.input == "auth_token" && value != "" {
+			value = "*****"
+		}
+		provenance = append(provenance, Provenance{Input: k.input, Value: value, Source: source})
+	}
+	return provenance, nil
+}
+
+// readSentryConfigFile parses either a Java-style sentry.properties file or
+// an INI-style .sentryclirc into `section.key` values.
+func readSentryConfigFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	isProperties := filepath.Ext(path) == ".properties"
+	values := map[string]string{}
+	section := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "!") {
+			continue
+		}
+		if !isProperties && strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+
+		sep := strings.IndexAny(line, "=:")
+		if sep < 0 {
+			continue
+		}
+		key := strings.TrimSpace(line[:sep])
+		if section != "" {
+			key = section + "." + key
+		}
+		values[key] = strings.TrimSpace(line[sep+1:])
+	}
+	return values, scanner.Err()
+}
+
+/// Prints where each Sentry setting came from
+func printProvenance(provenance []Provenance) {
+	var table strings.Builder
+	w := tabwriter.NewWriter(&table, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "- INPUT\tVALUE\tSOURCE")
+	for _, p := range provenance {
+		fmt.Fprintf(w, "- %s\t%s\t%s\n", p.Input, p.Value, p.Source)
+	}
+	if err := w.Flush(); err != nil {
+		logger.Warnf("%s", err)
+	}
+
+	logger.Infof("Sentry configuration:")
+	logger.Printf("%s", strings.TrimSuffix(table.String(), "\n"))
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMergeSentryConfig(t *testing.T) {
+	dir := t.TempDir()
+	properties := filepath.Join(dir, "sentry.properties")
+	writeTestFile(t, properties, []byte(`# generated by the Sentry wizard
+defaults.org=properties-org
+defaults.project=properties-project
+auth.token=properties-token
+`))
+	rc := filepath.Join(dir, ".sentryclirc")
+	writeTestFile(t, rc, []byte(`[defaults]
+url = https://sentry.example.com/
+org = rc-org
+
+[auth]
+token = rc-token
+`))
+
+	cfg := Config{ProjectSlug: "input-project"}
+	provenance, err := mergeSentryConfig(&cfg, []string{properties, rc})
+	if err != nil {
+		t.Fatalf("Test failed: %v", err)
+	}
+
+	expected := Config{
+		SentryURL:   "https://sentry.example.com/",
+		OrgSlug:     "properties-org",
+		ProjectSlug: "input-project",
+		AuthToken:   "properties-token",
+	}
+	if !reflect.DeepEqual(cfg, expected) {
+		t.Errorf("Test failed: expected %+v but got %+v", expected, cfg)
+	}
+
+	expectedProvenance := []Provenance{
+		{Input: "sentry_url", Value: "https://sentry.example.com/", Source: rc},
+		{Input: "org_slug", Value: "properties-org", Source: properties},
+		{Input: "project_slug", Value: "input-project", Source: "step input"},
+		{Input: "auth_token", Value: "*****", Source: properties},
+	}
+	if !reflect.DeepEqual(provenance, expectedProvenance) {
+		t.Errorf("Test failed: expected %v but got %v", expectedProvenance, provenance)
+	}
+}
+
+func TestMergeSentryConfig_DefaultURL(t *testing.T) {
+	cfg := Config{}
+	if _, err := mergeSentryConfig(&cfg, []string{}); err != nil {
+		t.Fatalf("Test failed: %v", err)
+	}
+	if cfg.SentryURL != defaultSentryURL {
+		t.Errorf("Test failed: expected %s but got %s", defaultSentryURL, cfg.SentryURL)
+	}
+
+	if _, err := mergeSentryConfig(&cfg, []string{"does/not/exist"}); err == nil {
+		t.Errorf("Test failed: expected an error for a missing config file")
+	}
+}
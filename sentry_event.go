@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+/// Client name reported to Sentry with the test event
+const sentryClientName = "bitrise-step-sentry-upload/1.0"
+
+/// How long to wait for Sentry to accept the test event
+const testEventTimeout = 30 * time.Second
+
+/// Most of an error response shown when Sentry rejects the test event
+const maxErrorBodySize = 512
+
+// parseDSN splits a Sentry DSN such as `https://key@o1.ingest.sentry.io/42`
+// into the URL of its project's store endpoint and its public key
+func parseDSN(dsn string) (string, string, error) {
+	u, err := url.Parse(strings.TrimSpace(dsn))
+	if err != nil {
+		return "", "", fmt.Errorf("invalid DSN: %v", err)
+	}
+	key := u.User.Username()
+	path := strings.TrimSuffix(u.Path, "/")
+	slash := strings.LastIndex(path, "/")
+	if u.Scheme == "" || u.Host == "" || key == "" || slash < 0 || slash == len(path)-1 {
+		return "", "", errors.New("invalid DSN, expected <scheme>://<key>@<host>/<project>")
+	}
+	project := path[slash+1:]
+	store := url.URL{Scheme: u.Scheme, Host: u.Host, Path: path[:slash] + "/api/" + project + "/store/"}
+	return store.String(), key, nil
+}
+
+// sendTestEvent sends a synthetic info event tagged with the release and
+// dist to the project of dsn, along with the custom headers, returning the ID
+// of the event once Sentry has accepted it. Requests go through transport, so
+// they can be stubbed.
+func sendTestEvent(dsn, release, dist string, headers HeaderList, transport http.RoundTripper) (string, error) {
+	storeURL, key, err := parseDSN(dsn)
+	if err != nil {
+		return "", err
+	}
+	id := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, id); err != nil {
+		return "", err
+	}
+	eventID := hex.EncodeToString(id)
+
+	event := map[string]interface{}{
+		"event_id":  eventID,
+		"timestamp": time.Now().UTC().Format(time.RFC3339),
+		"platform":  "other",
+		"level":     "info",
+		"logger":    "bitrise-step-sentry-upload",
+		"message":   "Test event sent by the Sentry Upload step after uploading symbols",
+		"tags":      map[string]string{"source": "bitrise-step-sentry-upload"},
+	}
+	if release != "" {
+		event["release"] = release
+	}
+	if dist != "" {
+		event["dist"] = dist
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, storeURL, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	setCustomHeaders(req, headers)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Sentry-Auth", fmt.Sprintf("Sentry sentry_version=7, sentry_client=%s, sentry_key=%s", sentryClientName, key))
+	client := http.Client{Transport: transport, Timeout: testEventTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to send the test event: %v", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		reason := resp.Header.Get("X-Sentry-Error")
+		if reason == "" {
+			reason = strings.TrimSpace(string(respBody))
+			if len(reason) > maxErrorBodySize {
+				reason = reason[:maxErrorBodySize] + "..."
+			}
+		}
+		return "", fmt.Errorf("the test event was rejected with %s: %s", resp.Status, reason)
+	}
+	var accepted struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(respBody, &accepted); err != nil || accepted.ID != eventID {
+		return "", fmt.Errorf("unexpected response to the test event: %s", strings.TrimSpace(string(respBody)))
+	}
+	return accepted.ID, nil
+}
+
+// verifyDelivery sends the test event for `verification_dsn`, recording the
+// outcome as a `verify` result of the report. The dist is the build number
+// of the release, when it has one.
+func verifyDelivery(cfg Config, transport http.RoundTripper) JobResult {
+	start := time.Now()
+	done := logger.Section("Sending a test event")
+	defer done()
+
+	dist := ""
+	if plus := strings.LastIndex(cfg.Release, "+"); plus >= 0 {
+		dist = cfg.Release[plus+1:]
+	}
+	result := JobResult{Job: UploadJob{ID: "verify"}}
+	eventID, err := sendTestEvent(cfg.VerificationDSN, cfg.Release, dist, cfg.CustomHeaders, transport)
+	result.Duration = time.Since(start)
+	if err != nil {
+		result.Status = StatusFailed
+		result.Reason = err.Error()
+		return result
+	}
+	logger.Donef("Sentry accepted test event %s", eventID)
+	result.Status = StatusVerified
+	result.Reason = "event " + eventID
+	return result
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bitrise-io/go-steputils/stepconf"
+)
+
+// Kinds of Sentry auth tokens, told apart by their prefix
+const (
+	tokenTypeOrg    = "organization"
+	tokenTypeUser   = "user"
+	tokenTypeLegacy = "legacy"
+)
+
+/// Prefixes of organization and user auth tokens
+const (
+	orgTokenPrefix  = "sntrys_"
+	userTokenPrefix = "sntryu_"
+)
+
+/// How long to wait for Sentry to describe the auth token
+const tokenCheckTimeout = 30 * time.Second
+
+// uploadScopes are the scopes allowing release and debug file uploads, any
+// one of which is enough. Organization tokens get theirs through `org:ci`.
+var uploadScopes = []string{"project:releases", "project:write", "project:admin", "org:ci"}
+
+// OrgTokenClaims are the claims embedded in an organization auth token,
+// `sntrys_<base64 JSON claims>_<secret>`
+type OrgTokenClaims struct {
+	URL       string `json:"url"`
+	RegionURL string `json:"region_url"`
+	Org       string `json:"org"`
+}
+
+// detectTokenType tells organization tokens from user tokens, returning the
+// claims of organization tokens. Tokens without a known prefix are legacy
+// user tokens.
+func detectTokenType(token string) (string, *OrgTokenClaims) {
+	token = strings.TrimSpace(token)
+	if strings.HasPrefix(token, userTokenPrefix) {
+		return tokenTypeUser, nil
+	}
+	if !strings.HasPrefix(token, orgTokenPrefix) {
+		return tokenTypeLegacy, nil
+	}
+
+	body := strings.TrimPrefix(token, orgTokenPrefix)
+	if i := strings.LastIndex(body, "_"); i >= 0 {
+		body = body[:i]
+	}
+	payload, err := base64.StdEncoding.DecodeString(body)
+	if err != nil {
+		payload, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(body, "="))
+	}
+	claims := &OrgTokenClaims{}
+	if err != nil || json.Unmarshal(payload, claims) != nil {
+		return tokenTypeOrg, nil
+	}
+	return tokenTypeOrg, claims
+}
+
+// TokenRejectedError reports an auth token the Sentry API didn't accept
+type TokenRejectedError struct {
+	Reason string
+}
+
+// Error describes why the auth token was rejected
+func (e *TokenRejectedError) Error() string {
+	return "the auth token was rejected: " + e.Reason
+}
+
+// fetchTokenScopes asks the Sentry API which scopes the token grants,
+// sending the custom headers along
+func fetchTokenScopes(sentryURL, token string, headers HeaderList, transport http.RoundTripper) ([]string, error) {
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(sentryURL, "/")+"/api/0/", nil)
+	if err != nil {
+		return nil, err
+	}
+	setCustomHeaders(req, headers)
+	req.Header.Set("Authorization", "Bearer "+token)
+	client := http.Client{Transport: transport, Timeout: tokenCheckTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return nil, err
+	}
+	reason := fmt.Sprintf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return nil, &TokenRejectedError{Reason: reason}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(reason)
+	}
+	var index struct {
+		Auth *struct {
+			Scopes []string `json:"scopes"`
+		} `json:"auth"`
+	}
+	if err := json.Unmarshal(body, &index); err != nil {
+		return nil, fmt.Errorf("unexpected response: %v", err)
+	}
+	if index.Auth == nil {
+		return nil, &TokenRejectedError{Reason: "no token found for it on " + sentryURL}
+	}
+	return index.Auth.Scopes, nil
+}
+
+// resolveTokenURL points the step at the Sentry URL embedded in an
+// organization auth token when none is configured, instead of the default,
+// so sentry-cli reaches the token's region. The provenance of `sentry_url`
+// is updated to match.
+func resolveTokenURL(cfg *Config, provenance []Provenance) {
+	_, claims := detectTokenType(string(cfg.AuthToken))
+	if claims == nil || claims.URL == "" {
+		return
+	}
+	for i, p := range provenance {
+		if p.Input == "sentry_url" && p.Source == "default" {
+			cfg.SentryURL = claims.URL
+			provenance[i].Value = claims.URL
+			provenance[i].Source = "auth token"
+		}
+	}
+}
+
+// checkAuthToken fails early on an auth token that can't upload, instead of
+// sentry-cli failing with a 403 halfway through the run. Organization tokens
+// must belong to `org_slug`. The token's scopes are then checked against the
+// API; failing to reach it only warns, as uploads may still work.
+func checkAuthToken(cfg Config, transport http.RoundTripper) error {
+	tokenType, claims := detectTokenType(string(cfg.AuthToken))
+	logger.Printf("Auth token type: %s", tokenType)
+	if claims != nil && claims.Org != "" && cfg.OrgSlug != "" && claims.Org != cfg.OrgSlug {
+		return fmt.Errorf("the auth token belongs to the %s organization but org_slug is %s", claims.Org, cfg.OrgSlug)
+	}
+
+	scopes, err := fetchTokenScopes(cfg.SentryURL, string(cfg.AuthToken), cfg.CustomHeaders, transport)
+	var rejected *TokenRejectedError
+	if errors.As(err, &rejected) {
+		return err
+	}
+	if err != nil {
+		logger.Warnf("Couldn't check the scopes of the auth token: %s", err)
+		return nil
+	}
+	logger.Debugf("Auth token scopes: %s", strings.Join(scopes, ", "))
+	for _, scope := range scopes {
+		for _, required := range uploadScopes {
+			if scope == required {
+				return nil
+			}
+		}
+	}
+	granted := strings.Join(scopes, ", ")
+	if granted == "" {
+		granted = "none"
+	}
+	return fmt.Errorf("the %s auth token is missing the project:releases or project:write scope needed to upload, its scopes are: %s", tokenType, granted)
+}
+
+// resolveAuthToken reads the auth token from `auth_token_file`, or from the
+// stdout of `auth_token_command` run through bash, for pipelines getting
+// credentials from mounted files or a secret manager. At most one of them and
+// `auth_token` may be set. Tokens read this way are never logged.
+func resolveAuthToken(cfg *Config, cmd CommandExecutor) error {
+	sources := []string{}
+	for input, value := range map[string]string{
+		"auth_token":         string(cfg.AuthToken),
+		"auth_token_file":    cfg.AuthTokenFile,
+		"auth_token_command": cfg.AuthTokenCommand,
+	} {
+		if value != "" {
+			sources = append(sources, input)
+		}
+	}
+	if len(sources) > 1 {
+		sort.Strings(sources)
+		return fmt.Errorf("only one of auth_token, auth_token_file and auth_token_command can be set, got %s", strings.Join(sources, ", "))
+	}
+
+	var token string
+	switch {
+	case cfg.AuthTokenFile != "":
+		content, err := ioutil.ReadFile(cfg.AuthTokenFile)
+		if err != nil {
+			return fmt.Errorf("failed to read auth_token_file: %v", err)
+		}
+		token = string(content)
+	case cfg.AuthTokenCommand != "":
+		inv := newInvocation("bash", "-c", cfg.AuthTokenCommand)
+		inv.StdoutOnly = true
+		out, err := cmd.execute(inv)
+		if err != nil {
+			return fmt.Errorf("auth_token_command failed: %v: %s", err, strings.TrimSpace(string(out)))
+		}
+		token = string(out)
+	default:
+		return nil
+	}
+
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return fmt.Errorf("%s produced an empty auth token", sources[0])
+	}
+	cfg.AuthToken = stepconf.Secret(token)
+	return nil
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bitrise-io/go-steputils/stepconf"
+)
+
+/// Builds an organization auth token embedding the given claims
+func testOrgToken(url, org string) stepconf.Secret {
+	claims, _ := json.Marshal(map[string]interface{}{"iat": 1700000000.0, "url": url, "region_url": url, "org": org})
+	return stepconf.Secret(orgTokenPrefix + base64.StdEncoding.EncodeToString(claims) + "_c2VjcmV0")
+}
+
+func TestDetectTokenType(t *testing.T) {
+	t.Parallel()
+	tokenType, claims := detectTokenType(string(testOrgToken("https://sentry.example.com", "my-org")))
+	if tokenType != tokenTypeOrg || claims == nil || claims.Org != "my-org" || claims.URL != "https://sentry.example.com" {
+		t.Errorf("Test failed: expected organization token claims but got %s %+v", tokenType, claims)
+	}
+	if tokenType, _ := detectTokenType("sntryu_0123456789abcdef"); tokenType != tokenTypeUser {
+		t.Errorf("Test failed: expected a user token but got %s", tokenType)
+	}
+	if tokenType, _ := detectTokenType("abcd12345"); tokenType != tokenTypeLegacy {
+		t.Errorf("Test failed: expected a legacy token but got %s", tokenType)
+	}
+}
+
+func TestCheckAuthToken(t *testing.T) {
+	t.Parallel()
+	scopes := map[string][]string{
+		"sntryu_releases": {"project:read", "project:releases"},
+		"sntryu_readonly": {"project:read", "org:read"},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/0/" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Header.Get("X-Gateway-Key") != "gateway-secret" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if strings.HasPrefix(token, orgTokenPrefix) {
+			json.NewEncoder(w).Encode(map[string]interface{}{"auth": map[string]interface{}{"scopes": []string{"org:ci"}}})
+			return
+		}
+		granted, ok := scopes[token]
+		if !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"detail":"Invalid token"}`))
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"auth": map[string]interface{}{"scopes": granted}})
+	}))
+	defer server.Close()
+
+	var tests = []struct {
+		cfg Config
+		err string
+	}{
+		{cfg: Config{AuthToken: "sntryu_releases", OrgSlug: "my-org", SentryURL: server.URL}},
+		{cfg: Config{AuthToken: "sntryu_readonly", OrgSlug: "my-org", SentryURL: server.URL}, err: "missing the project:releases or project:write scope"},
+		{cfg: Config{AuthToken: "sntryu_revoked", OrgSlug: "my-org", SentryURL: server.URL}, err: "401"},
+		{cfg: Config{AuthToken: testOrgToken(server.URL, "my-org"), OrgSlug: "my-org", SentryURL: server.URL}},
+		{cfg: Config{AuthToken: testOrgToken(server.URL, "other-org"), OrgSlug: "my-org", SentryURL: server.URL}, err: "belongs to the other-org organization"},
+	}
+
+	for _, test := range tests {
+		cfg := test.cfg
+		cfg.CustomHeaders = "X-Gateway-Key: gateway-secret"
+		err := checkAuthToken(cfg, http.DefaultTransport)
+		if test.err == "" && err != nil {
+			t.Errorf("Test failed: %v", err)
+		}
+		if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("Test failed: expected an error containing %q but got %v", test.err, err)
+		}
+	}
+
+	withoutHeaders := Config{AuthToken: "sntryu_releases", OrgSlug: "my-org", SentryURL: server.URL}
+	if err := checkAuthToken(withoutHeaders, http.DefaultTransport); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("Test failed: expected the gateway to reject a request without custom headers but got %v", err)
+	}
+
+	unreachable := Config{AuthToken: "sntryu_releases", OrgSlug: "my-org", SentryURL: "http://127.0.0.1:1"}
+	if err := checkAuthToken(unreachable, http.DefaultTransport); err != nil {
+		t.Errorf("Test failed: expected an unreachable API to only warn but got %v", err)
+	}
+}
+
+func TestResolveTokenURL(t *testing.T) {
+	t.Parallel()
+	regional := "https://us.sentry.io"
+	var tests = []struct {
+		token    stepconf.Secret
+		source   string
+		expected string
+	}{
+		{token: testOrgToken(regional, "my-org"), source: "default", expected: regional},
+		{token: testOrgToken(regional, "my-org"), source: "step input", expected: defaultSentryURL},
+		{token: "sntryu_releases", source: "default", expected: defaultSentryURL},
+	}
+
+	for _, test := range tests {
+		cfg := Config{AuthToken: test.token, SentryURL: defaultSentryURL}
+		provenance := []Provenance{{Input: "sentry_url", Value: defaultSentryURL, Source: test.source}}
+		resolveTokenURL(&cfg, provenance)
+		if cfg.SentryURL != test.expected || provenance[0].Value != test.expected {
+			t.Errorf("Test failed: expected %s from a %s URL but got %s, %+v", test.expected, test.source, cfg.SentryURL, provenance)
+		}
+	}
+}
+
+func TestResolveAuthToken(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "token")
+	writeTestFile(t, tokenFile, []byte("from-file\n"))
+	emptyFile := filepath.Join(dir, "empty")
+	writeTestFile(t, emptyFile, []byte(" \n"))
+
+	var tests = []struct {
+		cfg      Config
+		cmd      *RecordingExecutor
+		expected stepconf.Secret
+		err      string
+	}{
+		{cfg: Config{AuthToken: "from-input"}, cmd: respondWith(""), expected: "from-input"},
+		{cfg: Config{AuthTokenFile: tokenFile}, cmd: respondWith(""), expected: "from-file"},
+		{cfg: Config{AuthTokenCommand: "vault kv get -field=token secret/sentry"}, cmd: respondWith("from-command\n"), expected: "from-command"},
+		{cfg: Config{AuthTokenCommand: "false"}, cmd: failWith("permission denied", errors.New("exit status 1")), err: "auth_token_command failed: exit status 1: permission denied"},
+		{cfg: Config{AuthTokenFile: emptyFile}, cmd: respondWith(""), err: "auth_token_file produced an empty auth token"},
+		{cfg: Config{AuthTokenFile: filepath.Join(dir, "missing")}, cmd: respondWith(""), err: "failed to read auth_token_file"},
+		{cfg: Config{AuthToken: "from-input", AuthTokenFile: tokenFile}, cmd: respondWith(""), err: "got auth_token, auth_token_file"},
+	}
+
+	for _, test := range tests {
+		cfg := test.cfg
+		err := resolveAuthToken(&cfg, test.cmd)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("Test failed: expected an error containing %q but got %v", test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test failed: %v", err)
+		}
+		if cfg.AuthToken != test.expected {
+			t.Errorf("Test failed: expected token %q but got %q", test.expected, string(cfg.AuthToken))
+		}
+	}
+
+	cmd := respondWith("from-command")
+	cfg := Config{AuthTokenCommand: "op read op://ci/sentry/token"}
+	if err := resolveAuthToken(&cfg, cmd); err != nil {
+		t.Fatalf("Test failed: %v", err)
+	}
+	expected := []Invocation{{Command: "bash", Args: []string{"-c", "op read op://ci/sentry/token"}, StdoutOnly: true}}
+	if calls := cmd.Calls(); !reflect.DeepEqual(calls, expected) {
+		t.Errorf("Test failed: expected %v but got %v", expected, calls)
+	}
+	if printed := fmt.Sprintf("%v", cfg.AuthToken); strings.Contains(printed, "from-command") {
+		t.Errorf("Test failed: the resolved token is printed as %s", printed)
+	}
+}